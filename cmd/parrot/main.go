@@ -4,6 +4,7 @@
 package main
 
 import (
+	"errors"
 	goflag "flag"
 	"fmt"
 	"net"
@@ -15,8 +16,11 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/sapcc/go-traceroute/traceroute"
+	"github.com/sapcc/kube-parrot/pkg/bgp"
+	"github.com/sapcc/kube-parrot/pkg/controller"
 	"github.com/sapcc/kube-parrot/pkg/metrics"
 	"github.com/sapcc/kube-parrot/pkg/parrot"
+	"github.com/sapcc/kube-parrot/pkg/util"
 	flag "github.com/spf13/pflag"
 	"golang.org/x/net/context"
 )
@@ -25,21 +29,65 @@ type Neighbors []*net.IP
 
 var opts parrot.Options
 var neighbors Neighbors
+var configPath string
+var shutdownPrepend uint8
+var drainPrepend uint8
+var namespaceSelector, serviceSelector string
+var announceOptIn bool
 
 func init() {
 	flag.IntVar(&opts.As, "as", 65000, "local BGP ASN")
 	flag.IntVar(&opts.RemoteAs, "remote-as", 0, "remote BGP ASN. Default to local ASN (iBGP)")
 	flag.StringVar(&opts.NodeName, "nodename", "", "Name of the node this pod is running on")
 	flag.IPVar(&opts.HostIP, "hostip", net.ParseIP("127.0.0.1"), "IP")
+	flag.IPVar(&opts.HostIPv6, "hostipv6", nil, "IPv6 address used as next hop for IPv6 announcements")
 	flag.IntVar(&opts.MetricsPort, "metric-port", 30039, "Port for Prometheus metrics")
 	flag.Var(&neighbors, "neighbor", "IP address of a neighbor. Can be specified multiple times...")
 	flag.IntVar(&opts.TraceCount, "traceroute-count", 10, "Amount of traceroute packets to send with ttl of 1 for dynamic neighbor discovery")
 	flag.IntVar(&opts.NeighborCount, "neighbor-count", 2, "Amount of expected BGP neighbors. Used with dynamic neighbor discovery")
 	flag.BoolVar(&opts.PodSubnet, "podsubnet", true, "Announce node podCIDR")
+	flag.StringVar(&configPath, "config", util.ConfigPath, "Path to the config file. Neighbors configured there take precedence over --neighbor and --remote-as")
+	flag.DurationVar(&opts.GracefulRestartTime, "graceful-restart-time", 0, "Negotiate graceful restart with this restart time, so neighbors keep forwarding while parrot restarts. Disabled if 0")
+	flag.DurationVar(&opts.LongLivedGracefulRestartTime, "long-lived-graceful-restart-time", 0, "Negotiate long-lived graceful restart with this stale time. Requires --graceful-restart-time. Disabled if 0")
+	flag.StringVar(&opts.Shutdown.Depreference.Mode, "shutdown-deprefer", "", "Deprefer all routes on shutdown before withdrawing them: community (GRACEFUL_SHUTDOWN, RFC 8326) or prepend (eBGP only). Disabled if empty")
+	flag.Uint8Var(&shutdownPrepend, "shutdown-prepend", 3, "Number of times the local AS is prepended with --shutdown-deprefer=prepend")
+	flag.DurationVar(&opts.Shutdown.DrainTime, "shutdown-drain-time", 0, "Time to wait for traffic to drain on shutdown before withdrawing routes")
+	flag.BoolVar(&opts.Shutdown.Withdraw, "shutdown-withdraw", true, "Withdraw all routes on shutdown. Defaults to false with --graceful-restart-time, as neighbors would drop the routes instead of keeping them during the restart")
+	flag.DurationVar(&opts.Shutdown.Timeout, "shutdown-timeout", 25*time.Second, "Upper bound for the shutdown sequence. Keep it below the pod's termination grace period")
+	flag.StringVar(&opts.Drain.Taint, "drain-taint", "", "Drain the node while it has a taint with this key, like when it's cordoned or annotated with parrot.sap.cc/drain=true. Disabled if empty")
+	flag.StringVar(&opts.Drain.Depreference.Mode, "drain-deprefer", bgp.DepreferCommunity, "Deprefer service routes of a draining node before withdrawing them: community, prepend (eBGP only) or local-pref. Disabled if empty")
+	flag.Uint8Var(&drainPrepend, "drain-prepend", 3, "Number of times the local AS is prepended with --drain-deprefer=prepend")
+	flag.Uint32Var(&opts.Drain.Depreference.LocalPref, "drain-local-pref", 0, "LOCAL_PREF announced with --drain-deprefer=local-pref")
+	flag.DurationVar(&opts.Drain.Time, "drain-time", 30*time.Second, "Time service routes of a draining node stay depreferred before they are withdrawn. Pod subnet routes stay announced")
+	flag.DurationVar(&opts.HoldDown.AnnounceDelay, "announce-delay", 0, "Announce a route only after it was continuously wanted, e.g. had ready endpoints, for this long")
+	flag.DurationVar(&opts.HoldDown.WithdrawDelay, "withdraw-delay", 0, "Keep announcing a route for this long after its service lost its serving endpoints or health. Deleted services and removed IPs are withdrawn right away")
+	flag.BoolVar(&opts.KubeProxyWatchdog, "kube-proxy-watchdog", false, "Withdraw ExternalIP and LoadBalancer routes while the local kube-proxy is unready or its last sync is stale")
+	flag.DurationVar(&opts.KubeProxyStaleTime, "kube-proxy-stale-time", 2*time.Minute, "Age of kube-proxy's last sync after which the dataplane is considered stale")
+	flag.BoolVar(&opts.BFD, "bfd", false, "Run BFD with every neighbor and reset the BGP session when it goes down")
+	flag.DurationVar(&opts.BFDMinTx, "bfd-min-tx", 300*time.Millisecond, "Desired minimum BFD transmit interval")
+	flag.DurationVar(&opts.BFDMinRx, "bfd-min-rx", 300*time.Millisecond, "Required minimum BFD receive interval")
+	flag.IntVar(&opts.BFDMultiplier, "bfd-multiplier", 3, "BFD detection time multiplier")
+	flag.StringVar(&opts.Daemon.Daemon, "daemon", "", "Announce routes with an external routing daemon instead of the embedded GoBGP: frr or bird. Disabled if empty")
+	flag.StringVar(&opts.Daemon.ConfigPath, "daemon-config", "", "Path the routing daemon's BGP config is rendered to. Defaults to /etc/frr/parrot.conf, which is merged into /etc/frr/frr.conf on reload, or /etc/bird/parrot.conf, which bird.conf must include")
+	flag.StringSliceVar(&opts.Daemon.ReloadCommand, "daemon-reload-command", nil, "Command that makes the routing daemon apply the rendered config, as comma-separated arguments. Defaults to frr-reload.py with the merged config or birdc configure")
+	flag.StringVar(&namespaceSelector, "namespace-selector", "", "Only announce services in namespaces matching this label selector. All namespaces if empty")
+	flag.StringVar(&serviceSelector, "service-selector", "", "Only announce services matching this label selector. All services if empty")
+	flag.BoolVar(&announceOptIn, "announce-opt-in", false, "Only announce services annotated with parrot.sap.cc/announce=true. Otherwise services opt out with parrot.sap.cc/announce=false")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "Compute the routes from the cluster state and log them, without opening BGP sessions. They are served on /routes of the metrics port")
+	flag.StringVar(&opts.LoadBalancerClass, "loadbalancer-class", "", "Announce LoadBalancer ingress IPs of Services with this loadBalancerClass. Disabled if empty")
 }
 
 func main() {
 	goflag.CommandLine.Parse([]string{})
+
+	if len(os.Args) > 1 && os.Args[1] == "plan" {
+		if err := plan(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.CommandLine.AddGoFlagSet(goflag.CommandLine)
 	flag.Parse()
 
@@ -47,14 +95,77 @@ func main() {
 		opts.RemoteAs = opts.As
 	}
 
+	// The restart time is a 12 bit field in the graceful restart capability,
+	// the long-lived stale time a 24 bit field.
+	if opts.GracefulRestartTime > 4095*time.Second {
+		glog.Fatalf("--graceful-restart-time must not exceed 4095s")
+	}
+	if opts.LongLivedGracefulRestartTime > 16777215*time.Second {
+		glog.Fatalf("--long-lived-graceful-restart-time must not exceed 16777215s")
+	}
+	if opts.LongLivedGracefulRestartTime > 0 && opts.GracefulRestartTime == 0 {
+		glog.Fatalf("--long-lived-graceful-restart-time requires --graceful-restart-time")
+	}
+	// Neighbors only keep the routes of a restarting speaker that weren't
+	// withdrawn, so withdrawing them on shutdown makes restarts not hitless.
+	if opts.GracefulRestartTime > 0 {
+		if !flag.CommandLine.Changed("shutdown-withdraw") {
+			opts.Shutdown.Withdraw = false
+			glog.Infof("Keeping routes announced on shutdown for graceful restart. Set --shutdown-withdraw=true to withdraw them")
+		} else if opts.Shutdown.Withdraw {
+			glog.Warningf("--shutdown-withdraw withdraws all routes on shutdown, so restarts aren't hitless despite --graceful-restart-time")
+		}
+	}
+
+	if opts.Shutdown.Depreference.Mode == bgp.DepreferPrepend {
+		opts.Shutdown.Depreference.Prepend = shutdownPrepend
+	}
+	if err := opts.Shutdown.Depreference.Validate(); err != nil {
+		glog.Fatalf("Invalid --shutdown-deprefer: %s", err)
+	}
+	if opts.Drain.Depreference.Mode == bgp.DepreferPrepend {
+		opts.Drain.Depreference.Prepend = drainPrepend
+	}
+	if err := opts.Drain.Depreference.Validate(); err != nil {
+		glog.Fatalf("Invalid --drain-deprefer: %s", err)
+	}
+
+	selector, err := controller.NewServiceSelector(namespaceSelector, serviceSelector, announceOptIn)
+	if err != nil {
+		glog.Fatalf("Invalid service selection: %s", err)
+	}
+	opts.ServiceSelector = selector
+
 	sigs := make(chan os.Signal, 1)
 	stop := make(chan struct{})
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
-	if neighbors != nil {
-		opts.Neighbors = neighbors
-	} else {
-		opts.Neighbors = getNeighbors()
+	// Neither sessions nor the prefix policy are set up from a config that
+	// couldn't be loaded or is only partially valid.
+	config, err := util.LoadConfig(configPath)
+	if errors.Is(err, util.ErrNoConfig) {
+		glog.Infof("Couldn't load config: %s", err)
+	} else if err != nil {
+		glog.Fatalf("Invalid config: %s", err)
+	}
+
+	if len(config.Neighbors) > 0 {
+		opts.Neighbors = config.Neighbors
+	} else if neighbors != nil {
+		opts.Neighbors = toNeighbors(neighbors)
+	} else if !opts.DryRun {
+		opts.Neighbors = toNeighbors(getNeighbors())
+	}
+
+	// iBGP neighbors reject paths containing their own AS, so prepending
+	// would withdraw the routes instead of depreferring them.
+	if allIBGP(opts.Neighbors) {
+		if opts.Shutdown.Depreference.Mode == bgp.DepreferPrepend {
+			glog.Fatalf("--shutdown-deprefer=prepend requires eBGP neighbors. Use community instead")
+		}
+		if opts.Drain.Depreference.Mode == bgp.DepreferPrepend {
+			glog.Fatalf("--drain-deprefer=prepend requires eBGP neighbors. Use community or local-pref instead")
+		}
 	}
 	opts.GrpcPort = 12345
 	parrot := parrot.New(opts)
@@ -62,7 +173,7 @@ func main() {
 	wg := &sync.WaitGroup{}
 	parrot.Run(opts, stop, wg)
 
-	go metrics.ServeMetrics(opts.HostIP, opts.MetricsPort, wg, stop)
+	go metrics.ServeMetrics(opts.HostIP, opts.MetricsPort, parrot.RoutesHandler(), wg, stop)
 
 	<-sigs      // Wait for signals
 	close(stop) // Stop all goroutines
@@ -89,6 +200,31 @@ func (s *Neighbors) Type() string {
 	return "neighborSlice"
 }
 
+// allIBGP checks whether all neighbors are in the local AS. Without
+// neighbors, --remote-as decides.
+func allIBGP(neighbors []util.Neighbor) bool {
+	if len(neighbors) == 0 {
+		return opts.RemoteAs == opts.As
+	}
+	for _, neighbor := range neighbors {
+		remoteAs := int(neighbor.RemoteAS)
+		if remoteAs == 0 {
+			remoteAs = opts.RemoteAs
+		}
+		if remoteAs != opts.As {
+			return false
+		}
+	}
+	return true
+}
+
+func toNeighbors(ips []*net.IP) (neighbors []util.Neighbor) {
+	for _, ip := range ips {
+		neighbors = append(neighbors, util.NewNeighbor(*ip))
+	}
+	return neighbors
+}
+
 // getNeighbors discovers next-hops by sending traceroute packets with ttl=1
 func getNeighbors() []*net.IP {
 	t := &traceroute.Tracer{
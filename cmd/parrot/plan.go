@@ -0,0 +1,215 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"errors"
+	goflag "flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/sapcc/kube-parrot/pkg/bgp"
+	"github.com/sapcc/kube-parrot/pkg/controller"
+	"github.com/sapcc/kube-parrot/pkg/healthcheck"
+	"github.com/sapcc/kube-parrot/pkg/simulation"
+	"github.com/sapcc/kube-parrot/pkg/util"
+	flag "github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const planUsage = `Usage: parrot plan --nodename NODE [flags] FILE...
+
+Prints the routes NODE would announce, given the Services, EndpointSlices,
+Endpoints, Nodes and Namespaces in FILE, e.g. the output of kubectl get -o
+yaml. Use - to read from stdin. Health checks configured by annotations are
+assumed to pass, unless --assume-healthy=false probes them from this
+machine. Services gated on health checks are listed on stderr.
+
+`
+
+type planOptions struct {
+	configPath        string
+	nodeName          string
+	hostIP            net.IP
+	hostIPv6          net.IP
+	podSubnet         bool
+	loadBalancerClass string
+	namespaceSelector string
+	serviceSelector   string
+	announceOptIn     bool
+	assumeHealthy     bool
+}
+
+// plan runs the controllers of a node against objects read from manifests
+// and prints the routes they announce.
+func plan(args []string) error {
+	var o planOptions
+	flags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	flags.StringVar(&o.configPath, "config", util.ConfigPath, "Path to the config file")
+	flags.StringVar(&o.nodeName, "nodename", "", "Name of the node to plan for")
+	flags.IPVar(&o.hostIP, "hostip", nil, "Next hop of IPv4 routes. Defaults to the node's InternalIP")
+	flags.IPVar(&o.hostIPv6, "hostipv6", nil, "Next hop of IPv6 routes. Defaults to the node's IPv6 InternalIP")
+	flags.BoolVar(&o.podSubnet, "podsubnet", true, "Announce node podCIDR")
+	flags.StringVar(&o.loadBalancerClass, "loadbalancer-class", "", "Announce LoadBalancer ingress IPs of Services with this loadBalancerClass. Disabled if empty")
+	flags.StringVar(&o.namespaceSelector, "namespace-selector", "", "Only announce services in namespaces matching this label selector. All namespaces if empty")
+	flags.StringVar(&o.serviceSelector, "service-selector", "", "Only announce services matching this label selector. All services if empty")
+	flags.BoolVar(&o.announceOptIn, "announce-opt-in", false, "Only announce services annotated with parrot.sap.cc/announce=true")
+	flags.BoolVar(&o.assumeHealthy, "assume-healthy", true, "Assume health checks of services pass instead of probing them from this machine")
+	flags.AddGoFlagSet(goflag.CommandLine)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, planUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if o.nodeName == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("--nodename and at least one file are required")
+	}
+
+	config, err := util.LoadConfig(o.configPath)
+	if errors.Is(err, util.ErrNoConfig) {
+		glog.Infof("Couldn't load config: %s", err)
+	} else if err != nil {
+		return fmt.Errorf("invalid config: %s", err)
+	}
+	policy, err := bgp.NewPrefixPolicy(config.AllowedPrefixes)
+	if err != nil {
+		return fmt.Errorf("invalid allowed prefixes: %s", err)
+	}
+	if _, err := bgp.ParseCommunities(config.Communities); err != nil {
+		return fmt.Errorf("invalid default communities in config: %s", err)
+	}
+
+	selector, err := controller.NewServiceSelector(o.namespaceSelector, o.serviceSelector, o.announceOptIn)
+	if err != nil {
+		return fmt.Errorf("invalid service selection: %s", err)
+	}
+
+	objs, err := readManifests(flags.Args())
+	if err != nil {
+		return err
+	}
+	if err := o.defaultHostIPs(objs); err != nil {
+		return err
+	}
+
+	h := simulation.New(simulation.Options{
+		NodeName:          o.nodeName,
+		HostIP:            o.hostIP,
+		HostIPv6:          o.hostIPv6,
+		PodSubnet:         o.podSubnet,
+		LoadBalancerClass: o.loadBalancerClass,
+		ServiceSelector:   selector,
+		PrefixPolicy:      policy,
+		AssumeHealthy:     o.assumeHealthy,
+	})
+	for _, obj := range objs {
+		if !h.Supports(obj) {
+			glog.V(2).Infof("Ignoring unsupported object %T", obj)
+			continue
+		}
+		if err := h.Apply(obj); err != nil {
+			return err
+		}
+	}
+
+	if err := h.Start(); err != nil {
+		return err
+	}
+	defer h.Stop()
+
+	for _, route := range h.Speaker.Routes() {
+		fmt.Println(route)
+	}
+	if refused, conflicts := h.Server.RefusedRoutes(), h.Server.Conflicts(); refused > 0 || conflicts > 0 {
+		fmt.Fprintf(os.Stderr, "%d routes refused by allowed prefixes, %d conflicting prefixes\n", refused, conflicts)
+	}
+	o.printHealthGated(objs)
+	return nil
+}
+
+// printHealthGated lists the services whose routes depend on a health
+// check, as the plan can't tell whether they would pass on the node.
+func (o *planOptions) printHealthGated(objs []runtime.Object) {
+	result := "probed from this machine"
+	if o.assumeHealthy {
+		result = "assumed to pass"
+	}
+
+	var gated []string
+	for _, obj := range objs {
+		svc, ok := obj.(*v1.Service)
+		if !ok {
+			continue
+		}
+		if check, err := healthcheck.ServiceCheck(svc); err == nil && check != nil {
+			gated = append(gated, fmt.Sprintf("%s/%s is gated on a health check (%s)", svc.Namespace, svc.Name, check.Type))
+		}
+	}
+	sort.Strings(gated)
+	for _, service := range gated {
+		fmt.Fprintf(os.Stderr, "%s, %s\n", service, result)
+	}
+}
+
+// readManifests reads the objects of all files. Endpoints are mirrored to
+// EndpointSlices.
+func readManifests(paths []string) ([]runtime.Object, error) {
+	var objs []runtime.Object
+	for _, path := range paths {
+		var r io.Reader = os.Stdin
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		read, err := simulation.ReadManifests(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		objs = append(objs, read...)
+	}
+	return simulation.MirrorEndpoints(objs), nil
+}
+
+// defaultHostIPs takes the next hops that weren't given from the InternalIPs
+// of the node, like parrot's daemonset does.
+func (o *planOptions) defaultHostIPs(objs []runtime.Object) error {
+	var node *v1.Node
+	for _, obj := range objs {
+		if n, ok := obj.(*v1.Node); ok && n.Name == o.nodeName {
+			node = n
+		}
+	}
+
+	if o.hostIP == nil {
+		if node == nil {
+			return fmt.Errorf("node %s not found. Pass it in a file or set --hostip", o.nodeName)
+		}
+		ip, err := util.GetNodeInternalIP(node)
+		if err != nil {
+			return err
+		}
+		o.hostIP = net.ParseIP(ip)
+	}
+	if o.hostIPv6 == nil && node != nil {
+		if ip, err := util.GetNodeInternalIPOfFamily(node, true); err == nil {
+			o.hostIPv6 = net.ParseIP(ip)
+		}
+	}
+	return nil
+}
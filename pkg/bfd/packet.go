@@ -0,0 +1,133 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bfd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// State is the state of a BFD session (RFC 5880 section 4.1).
+type State uint8
+
+const (
+	StateAdminDown State = 0
+	StateDown      State = 1
+	StateInit      State = 2
+	StateUp        State = 3
+)
+
+// States lists all session states, e.g. for reporting metrics.
+var States = []State{StateAdminDown, StateDown, StateInit, StateUp}
+
+func (s State) String() string {
+	switch s {
+	case StateAdminDown:
+		return "admindown"
+	case StateDown:
+		return "down"
+	case StateInit:
+		return "init"
+	case StateUp:
+		return "up"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(s))
+}
+
+// Diagnostic tells the remote system why the session changed its state.
+type Diagnostic uint8
+
+const (
+	DiagNone                 Diagnostic = 0
+	DiagControlDetectExpired Diagnostic = 1
+	DiagNeighborSignaledDown Diagnostic = 3
+	DiagAdministrativelyDown Diagnostic = 7
+)
+
+const (
+	version             = 1
+	controlPacketLength = 24
+)
+
+// ControlPacket is a BFD control packet without authentication section
+// (RFC 5880 section 4.1).
+type ControlPacket struct {
+	Diagnostic                Diagnostic
+	State                     State
+	Poll                      bool
+	Final                     bool
+	DetectMult                uint8
+	MyDiscriminator           uint32
+	YourDiscriminator         uint32
+	DesiredMinTxInterval      uint32 // microseconds
+	RequiredMinRxInterval     uint32 // microseconds
+	RequiredMinEchoRxInterval uint32 // microseconds
+}
+
+func (p *ControlPacket) Marshal() []byte {
+	b := make([]byte, controlPacketLength)
+	b[0] = version<<5 | uint8(p.Diagnostic)&0x1f
+	b[1] = uint8(p.State) << 6
+	if p.Poll {
+		b[1] |= 0x20
+	}
+	if p.Final {
+		b[1] |= 0x10
+	}
+	b[2] = p.DetectMult
+	b[3] = controlPacketLength
+	binary.BigEndian.PutUint32(b[4:], p.MyDiscriminator)
+	binary.BigEndian.PutUint32(b[8:], p.YourDiscriminator)
+	binary.BigEndian.PutUint32(b[12:], p.DesiredMinTxInterval)
+	binary.BigEndian.PutUint32(b[16:], p.RequiredMinRxInterval)
+	binary.BigEndian.PutUint32(b[20:], p.RequiredMinEchoRxInterval)
+	return b
+}
+
+// UnmarshalControlPacket decodes a control packet and applies the checks
+// for discarding invalid packets from RFC 5880 section 6.8.6.
+func UnmarshalControlPacket(b []byte) (*ControlPacket, error) {
+	if len(b) < controlPacketLength {
+		return nil, errors.New("packet too short")
+	}
+	if b[0]>>5 != version {
+		return nil, fmt.Errorf("unsupported version %d", b[0]>>5)
+	}
+	length := int(b[3])
+	if length < controlPacketLength || length > len(b) {
+		return nil, fmt.Errorf("invalid length %d", length)
+	}
+	if b[1]&0x04 != 0 {
+		return nil, errors.New("authentication is not supported")
+	}
+	if b[1]&0x01 != 0 {
+		return nil, errors.New("multipoint bit must not be set")
+	}
+
+	p := &ControlPacket{
+		Diagnostic:                Diagnostic(b[0] & 0x1f),
+		State:                     State(b[1] >> 6),
+		Poll:                      b[1]&0x20 != 0,
+		Final:                     b[1]&0x10 != 0,
+		DetectMult:                b[2],
+		MyDiscriminator:           binary.BigEndian.Uint32(b[4:]),
+		YourDiscriminator:         binary.BigEndian.Uint32(b[8:]),
+		DesiredMinTxInterval:      binary.BigEndian.Uint32(b[12:]),
+		RequiredMinRxInterval:     binary.BigEndian.Uint32(b[16:]),
+		RequiredMinEchoRxInterval: binary.BigEndian.Uint32(b[20:]),
+	}
+
+	if p.DetectMult == 0 {
+		return nil, errors.New("detect multiplier must not be zero")
+	}
+	if p.MyDiscriminator == 0 {
+		return nil, errors.New("my discriminator must not be zero")
+	}
+	if p.YourDiscriminator == 0 && p.State != StateDown && p.State != StateAdminDown {
+		return nil, fmt.Errorf("your discriminator is zero in state %s", p.State)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bfd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestControlPacketRoundTrip(t *testing.T) {
+	packets := []ControlPacket{
+		{
+			State:                StateDown,
+			DetectMult:           3,
+			MyDiscriminator:      1,
+			DesiredMinTxInterval: 1000000,
+		},
+		{
+			Diagnostic:                DiagControlDetectExpired,
+			State:                     StateUp,
+			Poll:                      true,
+			DetectMult:                5,
+			MyDiscriminator:           0xdeadbeef,
+			YourDiscriminator:         0xcafebabe,
+			DesiredMinTxInterval:      300000,
+			RequiredMinRxInterval:     300000,
+			RequiredMinEchoRxInterval: 50000,
+		},
+		{
+			Diagnostic:            DiagAdministrativelyDown,
+			State:                 StateAdminDown,
+			Final:                 true,
+			DetectMult:            1,
+			MyDiscriminator:       0xffffffff,
+			YourDiscriminator:     42,
+			RequiredMinRxInterval: 1,
+		},
+	}
+
+	for _, p := range packets {
+		b := p.Marshal()
+		if len(b) != controlPacketLength {
+			t.Fatalf("%+v marshals to %d bytes, expected %d", p, len(b), controlPacketLength)
+		}
+		got, err := UnmarshalControlPacket(b)
+		if err != nil {
+			t.Fatalf("%+v doesn't unmarshal: %s", p, err)
+		}
+		if !reflect.DeepEqual(*got, p) {
+			t.Errorf("round trip of %+v returned %+v", p, *got)
+		}
+	}
+}
+
+func TestUnmarshalControlPacketDiscardsInvalid(t *testing.T) {
+	valid := (&ControlPacket{State: StateUp, DetectMult: 3, MyDiscriminator: 1, YourDiscriminator: 2}).Marshal()
+
+	tests := []struct {
+		name   string
+		modify func(b []byte) []byte
+	}{
+		{"too short", func(b []byte) []byte { return b[:controlPacketLength-1] }},
+		{"version", func(b []byte) []byte { b[0] = 2<<5 | b[0]&0x1f; return b }},
+		{"length too small", func(b []byte) []byte { b[3] = controlPacketLength - 1; return b }},
+		{"length exceeds packet", func(b []byte) []byte { b[3] = controlPacketLength + 1; return b }},
+		{"authentication", func(b []byte) []byte { b[1] |= 0x04; return b }},
+		{"multipoint", func(b []byte) []byte { b[1] |= 0x01; return b }},
+		{"zero detect multiplier", func(b []byte) []byte { b[2] = 0; return b }},
+		{"zero my discriminator", func(b []byte) []byte { copy(b[4:8], []byte{0, 0, 0, 0}); return b }},
+		{"zero your discriminator while up", func(b []byte) []byte { copy(b[8:12], []byte{0, 0, 0, 0}); return b }},
+	}
+
+	for _, tt := range tests {
+		b := tt.modify(append([]byte(nil), valid...))
+		if p, err := UnmarshalControlPacket(b); err == nil {
+			t.Errorf("%s: expected an error, got %+v", tt.name, p)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bfd
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Server runs single-hop BFD sessions (RFC 5881) with a set of peers. All
+// sessions share one socket for receiving control packets.
+type Server struct {
+	localAddress net.IP
+	config       Config
+
+	onStateChange func(peer string, old, new State)
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+	byDiscr  map[uint32]*Session
+}
+
+func NewServer(localAddress net.IP, config Config, onStateChange func(peer string, old, new State)) *Server {
+	return &Server{
+		localAddress:  localAddress,
+		config:        config,
+		onStateChange: onStateChange,
+		sessions:      make(map[string]*Session),
+		byDiscr:       make(map[uint32]*Session),
+	}
+}
+
+func (s *Server) Run(stopCh <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	wg.Add(1)
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: s.localAddress, Port: Port})
+	if err != nil {
+		glog.Errorf("Oops. Something went wrong starting BFD: %s", err)
+		return
+	}
+	go s.serve(conn)
+
+	<-stopCh
+	conn.Close()
+
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = make(map[string]*Session)
+	s.byDiscr = make(map[uint32]*Session)
+	s.mu.Unlock()
+
+	for _, session := range sessions {
+		session.stop()
+	}
+}
+
+// serve reads control packets and hands them to their sessions. Packets
+// that weren't sent with a TTL of 255 are dropped, as they can't originate
+// from a directly connected peer.
+func (s *Server) serve(conn *net.UDPConn) {
+	buf := make([]byte, 1500)
+
+	var read func() (int, int, net.Addr, error)
+	if s.localAddress.To4() != nil {
+		pc := ipv4.NewPacketConn(conn)
+		if err := pc.SetControlMessage(ipv4.FlagTTL, true); err != nil {
+			glog.Errorf("Couldn't enable TTL control messages for BFD: %s", err)
+		}
+		read = func() (int, int, net.Addr, error) {
+			n, cm, src, err := pc.ReadFrom(buf)
+			if cm == nil {
+				return n, 0, src, err
+			}
+			return n, cm.TTL, src, err
+		}
+	} else {
+		pc := ipv6.NewPacketConn(conn)
+		if err := pc.SetControlMessage(ipv6.FlagHopLimit, true); err != nil {
+			glog.Errorf("Couldn't enable hop limit control messages for BFD: %s", err)
+		}
+		read = func() (int, int, net.Addr, error) {
+			n, cm, src, err := pc.ReadFrom(buf)
+			if cm == nil {
+				return n, 0, src, err
+			}
+			return n, cm.HopLimit, src, err
+		}
+	}
+
+	for {
+		n, ttl, src, err := read()
+		if err != nil {
+			return
+		}
+		if ttl != 0 && ttl != 255 {
+			glog.V(5).Infof("Dropping BFD packet from %s with TTL %d", src, ttl)
+			continue
+		}
+
+		p, err := UnmarshalControlPacket(buf[:n])
+		if err != nil {
+			glog.V(5).Infof("Dropping invalid BFD packet from %s: %s", src, err)
+			continue
+		}
+
+		addr, ok := src.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		if session := s.lookup(p, addr.IP); session != nil {
+			select {
+			case session.rxCh <- p:
+			default:
+				glog.V(5).Infof("Dropping BFD packet from %s. Session is busy", src)
+			}
+		}
+	}
+}
+
+// lookup demultiplexes a packet by its discriminator or, if the peer doesn't
+// know ours yet, by its source address.
+func (s *Server) lookup(p *ControlPacket, src net.IP) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var session *Session
+	if p.YourDiscriminator != 0 {
+		session = s.byDiscr[p.YourDiscriminator]
+	} else {
+		session = s.sessions[src.String()]
+	}
+	if session == nil || !session.peer.Equal(src) {
+		return nil
+	}
+	return session
+}
+
+// AddPeer starts a session with the peer.
+func (s *Server) AddPeer(peer net.IP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[peer.String()]; exists {
+		return nil
+	}
+	if (peer.To4() != nil) != (s.localAddress.To4() != nil) {
+		return fmt.Errorf("BFD peer %s is not of the same address family as %s", peer, s.localAddress)
+	}
+
+	var discriminator uint32
+	for discriminator == 0 || s.byDiscr[discriminator] != nil {
+		discriminator = rand.Uint32()
+	}
+
+	session, err := newSession(s.localAddress, peer, discriminator, s.config, s.onStateChange)
+	if err != nil {
+		return err
+	}
+	s.sessions[peer.String()] = session
+	s.byDiscr[discriminator] = session
+
+	glog.Infof("Adding BFD session with %s", peer)
+	go session.run()
+	return nil
+}
+
+// RemovePeer signals AdminDown to the peer and stops the session.
+func (s *Server) RemovePeer(peer net.IP) {
+	s.mu.Lock()
+	session, exists := s.sessions[peer.String()]
+	if exists {
+		delete(s.sessions, peer.String())
+		delete(s.byDiscr, session.localDiscr)
+	}
+	s.mu.Unlock()
+
+	if exists {
+		glog.Infof("Removing BFD session with %s", peer)
+		session.stop()
+	}
+}
+
+// GetState returns the state of the session with the peer.
+func (s *Server) GetState(peer string) (State, bool) {
+	s.mu.Lock()
+	session, exists := s.sessions[peer]
+	s.mu.Unlock()
+
+	if !exists {
+		return StateAdminDown, false
+	}
+	return session.State(), true
+}
@@ -0,0 +1,317 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bfd
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// Port is the destination port of single-hop BFD control packets (RFC 5881).
+	Port = 3784
+
+	sourcePortMin = 49152
+	sourcePortMax = 65535
+	// slowTxInterval is the minimum transmit interval while a session is not up.
+	slowTxInterval = time.Second
+	ttl            = 255
+)
+
+// Config holds the timers of a BFD session.
+type Config struct {
+	DesiredMinTxInterval  time.Duration
+	RequiredMinRxInterval time.Duration
+	DetectMultiplier      uint8
+}
+
+// Session is a single-hop BFD session in asynchronous mode with one peer.
+type Session struct {
+	peer   net.IP
+	config Config
+	conn   *net.UDPConn
+
+	onStateChange func(peer string, old, new State)
+
+	mu                sync.Mutex
+	state             State
+	diagnostic        Diagnostic
+	localDiscr        uint32
+	remoteDiscr       uint32
+	remoteMinRx       time.Duration
+	remoteMinTx       time.Duration
+	remoteDetectMult  uint8
+	sendFinal         bool
+	detectionDeadline time.Time
+	// txMinTx is the transmit interval in use. polling is set while a
+	// change of the desired interval waits for the Final of the peer
+	// (RFC 5880 section 6.8.3).
+	txMinTx  time.Duration
+	polling  bool
+	sendPoll bool
+
+	rxCh   chan *ControlPacket
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+func newSession(local, peer net.IP, discriminator uint32, config Config, onStateChange func(string, State, State)) (*Session, error) {
+	conn, err := listenSourcePort(local)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		peer:          peer,
+		config:        config,
+		conn:          conn,
+		onStateChange: onStateChange,
+		state:         StateDown,
+		localDiscr:    discriminator,
+		remoteMinRx:   time.Microsecond,
+		rxCh:          make(chan *ControlPacket, 16),
+		stopCh:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	s.txMinTx = s.desiredMinTx()
+	return s, nil
+}
+
+// listenSourcePort binds a socket to a random port of the range mandated by
+// RFC 5881 and sets the TTL of outgoing packets to 255.
+func listenSourcePort(local net.IP) (*net.UDPConn, error) {
+	var err error
+	for i := 0; i < 100; i++ {
+		port := sourcePortMin + rand.Intn(sourcePortMax-sourcePortMin+1)
+
+		var conn *net.UDPConn
+		conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: local, Port: port})
+		if err != nil {
+			continue
+		}
+
+		if local.To4() != nil {
+			err = ipv4.NewConn(conn).SetTTL(ttl)
+		} else {
+			err = ipv6.NewConn(conn).SetHopLimit(ttl)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	return nil, fmt.Errorf("couldn't bind BFD source port: %s", err)
+}
+
+// State returns the current state of the session.
+func (s *Session) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *Session) run() {
+	defer close(s.done)
+	defer s.conn.Close()
+
+	txTimer := time.NewTimer(0)
+	defer txTimer.Stop()
+	detectTicker := time.NewTicker(10 * time.Millisecond)
+	defer detectTicker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			s.setState(StateAdminDown, DiagAdministrativelyDown)
+			s.send()
+			return
+		case p := <-s.rxCh:
+			s.receive(p)
+			if s.needsFinal() || s.needsPoll() {
+				s.send()
+				txTimer.Reset(s.txInterval())
+			}
+		case <-txTimer.C:
+			s.send()
+			txTimer.Reset(s.txInterval())
+		case now := <-detectTicker.C:
+			s.checkDetectionTime(now)
+		}
+	}
+}
+
+func (s *Session) stop() {
+	close(s.stopCh)
+	<-s.done
+}
+
+// receive runs the state machine of RFC 5880 section 6.8.6.
+func (s *Session) receive(p *ControlPacket) {
+	s.mu.Lock()
+	s.remoteDiscr = p.MyDiscriminator
+	s.remoteMinRx = time.Duration(p.RequiredMinRxInterval) * time.Microsecond
+	s.remoteMinTx = time.Duration(p.DesiredMinTxInterval) * time.Microsecond
+	s.remoteDetectMult = p.DetectMult
+	if p.Poll {
+		s.sendFinal = true
+	}
+	if p.Final && s.polling {
+		s.polling = false
+		s.txMinTx = s.desiredMinTx()
+	}
+	s.detectionDeadline = time.Now().Add(s.detectionTime())
+	state := s.state
+	s.mu.Unlock()
+
+	if state == StateAdminDown {
+		return
+	}
+
+	if p.State == StateAdminDown {
+		if state != StateDown {
+			s.setState(StateDown, DiagNeighborSignaledDown)
+		}
+		return
+	}
+
+	switch state {
+	case StateDown:
+		if p.State == StateDown {
+			s.setState(StateInit, DiagNone)
+		} else if p.State == StateInit {
+			s.setState(StateUp, DiagNone)
+		}
+	case StateInit:
+		if p.State == StateInit || p.State == StateUp {
+			s.setState(StateUp, DiagNone)
+		}
+	case StateUp:
+		if p.State == StateDown {
+			s.setState(StateDown, DiagNeighborSignaledDown)
+		}
+	}
+}
+
+func (s *Session) checkDetectionTime(now time.Time) {
+	s.mu.Lock()
+	expired := (s.state == StateInit || s.state == StateUp) && now.After(s.detectionDeadline)
+	s.mu.Unlock()
+
+	if expired {
+		s.setState(StateDown, DiagControlDetectExpired)
+	}
+}
+
+func (s *Session) setState(state State, diagnostic Diagnostic) {
+	s.mu.Lock()
+	old := s.state
+	s.state = state
+	s.diagnostic = diagnostic
+	if state == StateDown {
+		s.remoteDiscr = 0
+	}
+	// Coming up, the change of the desired interval is announced with a
+	// Poll sequence. A faster rate is used right away, as the peer adapts
+	// its detection time to it on receipt, but a slower one only after the
+	// Final. Leaving Up falls back to the slow rate without polling.
+	if desired := s.desiredMinTx(); state == StateUp && desired != s.txMinTx {
+		s.polling, s.sendPoll = true, true
+		if desired < s.txMinTx {
+			s.txMinTx = desired
+		}
+	} else if state != StateUp {
+		s.polling, s.sendPoll = false, false
+		s.txMinTx = desired
+	}
+	s.mu.Unlock()
+
+	if old != state {
+		glog.Infof("BFD session with %s changed state from %s to %s", s.peer, old, state)
+		if s.onStateChange != nil {
+			s.onStateChange(s.peer.String(), old, state)
+		}
+	}
+}
+
+// detectionTime must be called with the lock held.
+func (s *Session) detectionTime() time.Duration {
+	interval := s.config.RequiredMinRxInterval
+	if s.remoteMinTx > interval {
+		interval = s.remoteMinTx
+	}
+	return time.Duration(s.remoteDetectMult) * interval
+}
+
+// txInterval returns the jittered interval until the next periodic packet.
+func (s *Session) txInterval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	interval := s.txMinTx
+	if s.remoteMinRx > interval {
+		interval = s.remoteMinRx
+	}
+
+	// Reduce the interval by 0-25% (10-25% with a multiplier of 1) to
+	// avoid self-synchronization.
+	jitter := 75 + rand.Intn(26)
+	if s.config.DetectMultiplier == 1 {
+		jitter = 75 + rand.Intn(16)
+	}
+	return interval * time.Duration(jitter) / 100
+}
+
+// desiredMinTx must be called with the lock held.
+func (s *Session) desiredMinTx() time.Duration {
+	if s.state != StateUp && s.config.DesiredMinTxInterval < slowTxInterval {
+		return slowTxInterval
+	}
+	return s.config.DesiredMinTxInterval
+}
+
+func (s *Session) needsFinal() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sendFinal
+}
+
+// needsPoll reports whether a Poll sequence was started that wasn't sent
+// yet.
+func (s *Session) needsPoll() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sendPoll
+}
+
+func (s *Session) send() {
+	s.mu.Lock()
+	p := &ControlPacket{
+		Diagnostic:            s.diagnostic,
+		State:                 s.state,
+		Poll:                  s.polling && !s.sendFinal,
+		Final:                 s.sendFinal,
+		DetectMult:            s.config.DetectMultiplier,
+		MyDiscriminator:       s.localDiscr,
+		YourDiscriminator:     s.remoteDiscr,
+		DesiredMinTxInterval:  uint32(s.desiredMinTx() / time.Microsecond),
+		RequiredMinRxInterval: uint32(s.config.RequiredMinRxInterval / time.Microsecond),
+	}
+	s.sendFinal = false
+	if p.Poll {
+		s.sendPoll = false
+	}
+	s.mu.Unlock()
+
+	if _, err := s.conn.WriteToUDP(p.Marshal(), &net.UDPAddr{IP: s.peer, Port: Port}); err != nil {
+		glog.V(3).Infof("Failed to send BFD packet to %s: %s", s.peer, err)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bfd
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testConfig = Config{
+	DesiredMinTxInterval:  50 * time.Millisecond,
+	RequiredMinRxInterval: 50 * time.Millisecond,
+	DetectMultiplier:      3,
+}
+
+// loopbackPair runs two servers on different loopback addresses with a
+// session to each other.
+type loopbackPair struct {
+	a, b         *Server
+	addrA, addrB net.IP
+	stopA, stopB chan struct{}
+	wg           sync.WaitGroup
+	changesA     chan State
+	changesB     chan State
+}
+
+func newLoopbackPair(t *testing.T) *loopbackPair {
+	p := &loopbackPair{
+		addrA:    net.ParseIP("127.0.0.1"),
+		addrB:    net.ParseIP("127.0.0.2"),
+		stopA:    make(chan struct{}),
+		stopB:    make(chan struct{}),
+		changesA: make(chan State, 16),
+		changesB: make(chan State, 16),
+	}
+	for _, addr := range []net.IP{p.addrA, p.addrB} {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: addr, Port: Port})
+		if err != nil {
+			t.Skipf("Can't listen on %s:%d: %s", addr, Port, err)
+		}
+		conn.Close()
+	}
+
+	p.a = NewServer(p.addrA, testConfig, func(peer string, old, new State) { p.changesA <- new })
+	p.b = NewServer(p.addrB, testConfig, func(peer string, old, new State) { p.changesB <- new })
+	p.wg.Add(2)
+	go func() { defer p.wg.Done(); p.a.Run(p.stopA, &sync.WaitGroup{}) }()
+	go func() { defer p.wg.Done(); p.b.Run(p.stopB, &sync.WaitGroup{}) }()
+	// Give the servers time to bind their sockets.
+	time.Sleep(50 * time.Millisecond)
+
+	if err := p.a.AddPeer(p.addrB); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.b.AddPeer(p.addrA); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.stop)
+	return p
+}
+
+func (p *loopbackPair) stop() {
+	close(p.stopA)
+	close(p.stopB)
+	p.wg.Wait()
+}
+
+func (p *loopbackPair) session(s *Server, peer net.IP) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[peer.String()]
+}
+
+// awaitState waits for the transition to want and fails on any other state.
+func awaitState(t *testing.T, changes chan State, want ...State) {
+	t.Helper()
+	for _, state := range want {
+		select {
+		case got := <-changes:
+			if got != state {
+				t.Fatalf("expected state %s, got %s", state, got)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for state %s", state)
+		}
+	}
+}
+
+func TestSessionComesUp(t *testing.T) {
+	p := newLoopbackPair(t)
+
+	awaitState(t, p.changesA, StateInit, StateUp)
+	awaitState(t, p.changesB, StateInit, StateUp)
+
+	if state, ok := p.a.GetState(p.addrB.String()); !ok || state != StateUp {
+		t.Errorf("expected session with %s to be up, got %s", p.addrB, state)
+	}
+}
+
+func TestSessionPollsForFasterRate(t *testing.T) {
+	p := newLoopbackPair(t)
+
+	awaitState(t, p.changesA, StateInit, StateUp)
+	awaitState(t, p.changesB, StateInit, StateUp)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, session := range []*Session{p.session(p.a, p.addrB), p.session(p.b, p.addrA)} {
+		for {
+			session.mu.Lock()
+			polling, txMinTx := session.polling, session.txMinTx
+			session.mu.Unlock()
+
+			if !polling && txMinTx == testConfig.DesiredMinTxInterval {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("session with %s didn't finish its poll sequence", session.peer)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Both sides stay up at the faster rate.
+	time.Sleep(5 * time.Duration(testConfig.DetectMultiplier) * testConfig.RequiredMinRxInterval)
+	select {
+	case state := <-p.changesA:
+		t.Fatalf("unexpected state change to %s", state)
+	case state := <-p.changesB:
+		t.Fatalf("unexpected state change to %s", state)
+	default:
+	}
+}
+
+func TestSessionPollSequence(t *testing.T) {
+	local, peer := net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2")
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: peer, Port: Port})
+	if err != nil {
+		t.Skipf("Can't listen on %s:%d: %s", peer, Port, err)
+	}
+	defer conn.Close()
+
+	session, err := newSession(local, peer, 1, testConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go session.run()
+	defer session.stop()
+
+	read := func() *ControlPacket {
+		t.Helper()
+		buf := make([]byte, 1500)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := UnmarshalControlPacket(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	remote := func(state State, final bool) *ControlPacket {
+		return &ControlPacket{
+			State:                 state,
+			Final:                 final,
+			DetectMult:            3,
+			MyDiscriminator:       2,
+			YourDiscriminator:     1,
+			DesiredMinTxInterval:  uint32(testConfig.DesiredMinTxInterval / time.Microsecond),
+			RequiredMinRxInterval: uint32(testConfig.RequiredMinRxInterval / time.Microsecond),
+		}
+	}
+
+	p := read()
+	if p.State != StateDown || p.Poll || p.DesiredMinTxInterval != uint32(slowTxInterval/time.Microsecond) {
+		t.Fatalf("expected a slow Down packet without Poll, got %+v", p)
+	}
+
+	session.rxCh <- remote(StateInit, false)
+	for i := 0; i < 3; i++ {
+		p = read()
+		if p.State != StateUp || !p.Poll || p.DesiredMinTxInterval != uint32(testConfig.DesiredMinTxInterval/time.Microsecond) {
+			t.Fatalf("expected Up packets polling for the faster rate, got %+v", p)
+		}
+	}
+
+	session.rxCh <- remote(StateUp, true)
+	deadline := time.Now().Add(time.Second)
+	for p.Poll {
+		if time.Now().After(deadline) {
+			t.Fatal("session kept polling after the Final")
+		}
+		p = read()
+	}
+
+	// A Poll of the peer is answered with a Final, never with both bits.
+	poll := remote(StateUp, false)
+	poll.Poll = true
+	session.rxCh <- poll
+	deadline = time.Now().Add(time.Second)
+	for p = read(); !p.Final; p = read() {
+		if time.Now().After(deadline) {
+			t.Fatal("session didn't answer the Poll")
+		}
+	}
+	if p.Poll {
+		t.Fatalf("expected a Final without Poll, got %+v", p)
+	}
+}
+
+func TestSessionSignalsAdminDown(t *testing.T) {
+	p := newLoopbackPair(t)
+
+	awaitState(t, p.changesA, StateInit, StateUp)
+	awaitState(t, p.changesB, StateInit, StateUp)
+
+	p.a.RemovePeer(p.addrB)
+	awaitState(t, p.changesA, StateAdminDown)
+	awaitState(t, p.changesB, StateDown)
+
+	session := p.session(p.b, p.addrA)
+	session.mu.Lock()
+	diagnostic, txMinTx := session.diagnostic, session.txMinTx
+	session.mu.Unlock()
+	if diagnostic != DiagNeighborSignaledDown {
+		t.Errorf("expected diagnostic %d, got %d", DiagNeighborSignaledDown, diagnostic)
+	}
+	if txMinTx != slowTxInterval {
+		t.Errorf("expected the slow rate after going down, got %s", txMinTx)
+	}
+}
+
+func TestSessionDetectsSilentPeer(t *testing.T) {
+	p := newLoopbackPair(t)
+
+	awaitState(t, p.changesA, StateInit, StateUp)
+	awaitState(t, p.changesB, StateInit, StateUp)
+
+	// Closing the socket B sends from silences it without an AdminDown.
+	p.session(p.b, p.addrA).conn.Close()
+	awaitState(t, p.changesA, StateDown)
+
+	session := p.session(p.a, p.addrB)
+	session.mu.Lock()
+	diagnostic := session.diagnostic
+	session.mu.Unlock()
+	if diagnostic != DiagControlDetectExpired {
+		t.Errorf("expected diagnostic %d, got %d", DiagControlDetectExpired, diagnostic)
+	}
+}
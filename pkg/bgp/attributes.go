@@ -0,0 +1,220 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/osrg/gobgp/packet/bgp"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	AnnotationMED           = "parrot.sap.cc/med"
+	AnnotationLocalPref     = "parrot.sap.cc/local-pref"
+	AnnotationASPathPrepend = "parrot.sap.cc/as-path-prepend"
+
+	// AnnotationServeTerminating keeps routes to a service announced while
+	// its only endpoints are terminating, but still serving, so existing
+	// connections can drain.
+	AnnotationServeTerminating = "parrot.sap.cc/serve-terminating"
+	// AnnotationTerminatingDeprefer sets how these routes are depreferred
+	// meanwhile: community, prepend[=count] or local-pref[=value].
+	AnnotationTerminatingDeprefer = "parrot.sap.cc/terminating-deprefer"
+
+	defaultDepreferPrepend   = 3
+	defaultDepreferLocalPref = 50
+
+	maxASPathPrepend = 10
+
+	// DepreferCommunity tags routes with GRACEFUL_SHUTDOWN (RFC 8326),
+	// which neighbors are expected to match and lower LOCAL_PREF for.
+	DepreferCommunity = "community"
+	// DepreferPrepend prepends the local AS to the AS path of routes.
+	DepreferPrepend = "prepend"
+	// DepreferLocalPref announces routes with a low LOCAL_PREF. It only
+	// affects iBGP neighbors.
+	DepreferLocalPref = "local-pref"
+)
+
+// Depreference makes neighbors prefer other paths to the same prefixes,
+// e.g. before parrot withdraws its routes. The zero value leaves routes
+// untouched.
+type Depreference struct {
+	Mode      string
+	Prepend   uint8
+	LocalPref uint32
+}
+
+func (d Depreference) Validate() error {
+	switch d.Mode {
+	case "", DepreferCommunity, DepreferLocalPref:
+	case DepreferPrepend:
+		if d.Prepend == 0 || d.Prepend > maxASPathPrepend {
+			return fmt.Errorf("prepend count must be between 1 and %d", maxASPathPrepend)
+		}
+	default:
+		return fmt.Errorf("unknown depreference mode %q", d.Mode)
+	}
+	return nil
+}
+
+// PathAttributes are the per-route settings that are announced in addition
+// to ORIGIN and NEXT_HOP.
+type PathAttributes struct {
+	Communities *Communities
+	MED         *uint32
+	LocalPref   *uint32
+	// Prepend is the number of times the local AS is prepended to the AS
+	// path. It is only useful towards eBGP neighbors, as iBGP neighbors
+	// reject paths containing their own AS.
+	Prepend uint8
+}
+
+// ParseTrafficEngineering reads MED, LOCAL_PREF and AS-path prepend settings
+// from annotations. Invalid annotations are skipped and reported in the
+// error, the valid ones are returned nonetheless.
+func ParseTrafficEngineering(annotations map[string]string) (PathAttributes, error) {
+	attrs := PathAttributes{}
+	var errs []error
+
+	if v, ok := annotations[AnnotationMED]; ok {
+		if med, err := strconv.ParseUint(v, 10, 32); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %s", AnnotationMED, v, err))
+		} else {
+			attrs.MED = uint32Ptr(uint32(med))
+		}
+	}
+
+	if v, ok := annotations[AnnotationLocalPref]; ok {
+		if localPref, err := strconv.ParseUint(v, 10, 32); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %s", AnnotationLocalPref, v, err))
+		} else {
+			attrs.LocalPref = uint32Ptr(uint32(localPref))
+		}
+	}
+
+	if v, ok := annotations[AnnotationASPathPrepend]; ok {
+		if prepend, err := strconv.ParseUint(v, 10, 8); err != nil || prepend > maxASPathPrepend {
+			errs = append(errs, fmt.Errorf("invalid %s %q: must be a number between 0 and %d", AnnotationASPathPrepend, v, maxASPathPrepend))
+		} else {
+			attrs.Prepend = uint8(prepend)
+		}
+	}
+
+	return attrs, errors.Join(errs...)
+}
+
+// ServiceAttributes returns the path attributes requested for the routes of
+// a service by its annotations and the configured defaults. Invalid
+// annotations are skipped and reported in the error, the defaults and the
+// valid annotations are returned nonetheless.
+func ServiceAttributes(svc *v1.Service) (PathAttributes, error) {
+	attrs, err := ParseTrafficEngineering(svc.Annotations)
+
+	communities, communitiesErr := ServiceCommunities(svc)
+	attrs.Communities = communities
+
+	return attrs, errors.Join(err, communitiesErr)
+}
+
+// NodeAttributes returns the path attributes requested for the routes of a
+// node by its annotations.
+func NodeAttributes(node *v1.Node) (PathAttributes, error) {
+	return ParseTrafficEngineering(node.Annotations)
+}
+
+// ParseDepreference parses a depreference of the form mode[=value], e.g.
+// "community", "prepend=2" or "local-pref=50".
+func ParseDepreference(s string) (Depreference, error) {
+	d := Depreference{Mode: s, Prepend: defaultDepreferPrepend, LocalPref: defaultDepreferLocalPref}
+
+	if i := strings.Index(s, "="); i >= 0 {
+		d.Mode = s[:i]
+		value, err := strconv.ParseUint(s[i+1:], 10, 32)
+		if err != nil {
+			return Depreference{}, fmt.Errorf("invalid depreference %q: %s", s, err)
+		}
+		switch d.Mode {
+		case DepreferPrepend:
+			if value > maxASPathPrepend {
+				return Depreference{}, fmt.Errorf("invalid depreference %q: prepend count must be between 1 and %d", s, maxASPathPrepend)
+			}
+			d.Prepend = uint8(value)
+		case DepreferLocalPref:
+			d.LocalPref = uint32(value)
+		default:
+			return Depreference{}, fmt.Errorf("invalid depreference %q: %s takes no value", s, d.Mode)
+		}
+	}
+
+	return d, d.Validate()
+}
+
+// TerminatingEndpoints returns whether routes to a service are kept while
+// its endpoints are terminating, and how they are depreferred meanwhile.
+func TerminatingEndpoints(svc *v1.Service) (bool, Depreference, error) {
+	if svc.Annotations[AnnotationServeTerminating] != "true" {
+		return false, Depreference{}, nil
+	}
+
+	v, ok := svc.Annotations[AnnotationTerminatingDeprefer]
+	if !ok {
+		return true, Depreference{}, nil
+	}
+	d, err := ParseDepreference(v)
+	if err != nil {
+		return true, Depreference{}, fmt.Errorf("invalid %s: %s", AnnotationTerminatingDeprefer, err)
+	}
+	return true, d, nil
+}
+
+// depreferred returns the attributes with the given depreference applied.
+func (a PathAttributes) depreferred(d Depreference) PathAttributes {
+	switch d.Mode {
+	case DepreferCommunity:
+		communities := &Communities{}
+		if a.Communities != nil {
+			*communities = *a.Communities
+		}
+		communities.Standard = append(append([]uint32{}, communities.Standard...), uint32(bgp.COMMUNITY_PLANNED_SHUT))
+		a.Communities = communities
+	case DepreferPrepend:
+		a.Prepend += d.Prepend
+	case DepreferLocalPref:
+		a.LocalPref = uint32Ptr(d.LocalPref)
+	}
+	return a
+}
+
+// pathAttributes converts the settings into path attributes. localAS is
+// used for prepending.
+func (a PathAttributes) pathAttributes(localAS uint32) (pattr []bgp.PathAttributeInterface) {
+	if a.Prepend > 0 {
+		path := make([]uint32, a.Prepend)
+		for i := range path {
+			path[i] = localAS
+		}
+		pattr = append(pattr, bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{
+			bgp.NewAs4PathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, path),
+		}))
+	}
+	if a.MED != nil {
+		pattr = append(pattr, bgp.NewPathAttributeMultiExitDisc(*a.MED))
+	}
+	if a.LocalPref != nil {
+		pattr = append(pattr, bgp.NewPathAttributeLocalPref(*a.LocalPref))
+	}
+	if a.Communities != nil {
+		pattr = append(pattr, a.Communities.PathAttributes()...)
+	}
+	return pattr
+}
+
+func uint32Ptr(i uint32) *uint32 {
+	return &i
+}
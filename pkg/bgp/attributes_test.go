@@ -0,0 +1,85 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sapcc/kube-parrot/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServiceAttributesKeepValidAnnotations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("communities:\n  standard: [\"65000:1\"]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := util.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	// Other tests expect no default communities.
+	t.Cleanup(func() { util.LoadConfig(filepath.Join(t.TempDir(), "missing")) })
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		med         *uint32
+		localPref   *uint32
+		prepend     uint8
+		standard    []uint32
+		invalid     bool
+	}{
+		{
+			name:     "defaults only",
+			standard: []uint32{65000<<16 | 1},
+		},
+		{
+			name:        "valid annotations",
+			annotations: map[string]string{AnnotationMED: "10", AnnotationLocalPref: "200", AnnotationASPathPrepend: "2", AnnotationCommunities: "65000:2"},
+			med:         uint32Ptr(10),
+			localPref:   uint32Ptr(200),
+			prepend:     2,
+			standard:    []uint32{65000<<16 | 2, 65000<<16 | 1},
+		},
+		{
+			name:        "invalid community",
+			annotations: map[string]string{AnnotationCommunities: "65000:2,bogus", AnnotationMED: "10"},
+			med:         uint32Ptr(10),
+			standard:    []uint32{65000<<16 | 2, 65000<<16 | 1},
+			invalid:     true,
+		},
+		{
+			name:        "invalid MED",
+			annotations: map[string]string{AnnotationMED: "-1", AnnotationLocalPref: "200"},
+			localPref:   uint32Ptr(200),
+			standard:    []uint32{65000<<16 | 1},
+			invalid:     true,
+		},
+		{
+			name:        "invalid prepend",
+			annotations: map[string]string{AnnotationASPathPrepend: "11", AnnotationMED: "10"},
+			med:         uint32Ptr(10),
+			standard:    []uint32{65000<<16 | 1},
+			invalid:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "a", Annotations: tt.annotations}}
+		attrs, err := ServiceAttributes(svc)
+		if invalid := err != nil; invalid != tt.invalid {
+			t.Errorf("%s: expected invalid annotations: %t, got error %v", tt.name, tt.invalid, err)
+		}
+		if !reflect.DeepEqual(attrs.MED, tt.med) || !reflect.DeepEqual(attrs.LocalPref, tt.localPref) || attrs.Prepend != tt.prepend {
+			t.Errorf("%s: got MED %v, LOCAL_PREF %v, prepend %d", tt.name, attrs.MED, attrs.LocalPref, attrs.Prepend)
+		}
+		if attrs.Communities == nil || !reflect.DeepEqual(attrs.Communities.Standard, tt.standard) {
+			t.Errorf("%s: got communities %+v, expected %v", tt.name, attrs.Communities, tt.standard)
+		}
+	}
+}
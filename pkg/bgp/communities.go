@@ -0,0 +1,123 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sapcc/kube-parrot/pkg/util"
+
+	"github.com/osrg/gobgp/packet/bgp"
+	"github.com/osrg/gobgp/table"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	AnnotationCommunities         = "parrot.sap.cc/communities"
+	AnnotationExtendedCommunities = "parrot.sap.cc/extended-communities"
+	AnnotationLargeCommunities    = "parrot.sap.cc/large-communities"
+)
+
+// Communities holds the communities to attach to a path.
+type Communities struct {
+	Standard []uint32
+	Extended []bgp.ExtendedCommunityInterface
+	Large    []*bgp.LargeCommunity
+}
+
+// ParseCommunities parses standard ("65000:100" or well-known names like
+// "no-export"), extended ("rt:65000:100", "soo:10.0.0.1:100") and large
+// ("65000:1:2") communities. Invalid communities are skipped and reported
+// in the error, the valid ones are returned nonetheless.
+func ParseCommunities(c util.Communities) (*Communities, error) {
+	communities := &Communities{}
+	var errs []error
+
+	for _, s := range c.Standard {
+		community, err := parseStandardCommunity(s)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		communities.Standard = append(communities.Standard, community)
+	}
+
+	for _, s := range c.Extended {
+		community, err := table.ParseExtCommunity(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid extended community %q: %s", s, err))
+			continue
+		}
+		communities.Extended = append(communities.Extended, community)
+	}
+
+	for _, s := range c.Large {
+		community, err := bgp.ParseLargeCommunity(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid large community %q: %s", s, err))
+			continue
+		}
+		communities.Large = append(communities.Large, community)
+	}
+
+	return communities, errors.Join(errs...)
+}
+
+// ServiceCommunities returns the configured default communities together
+// with the ones requested by the service's annotations. Invalid annotated
+// communities are skipped, the defaults are always kept.
+func ServiceCommunities(svc *v1.Service) (*Communities, error) {
+	defaults := util.GetConfig().Communities
+	return ParseCommunities(util.Communities{
+		Standard: append(splitList(svc.Annotations[AnnotationCommunities]), defaults.Standard...),
+		Extended: append(splitList(svc.Annotations[AnnotationExtendedCommunities]), defaults.Extended...),
+		Large:    append(splitList(svc.Annotations[AnnotationLargeCommunities]), defaults.Large...),
+	})
+}
+
+// PathAttributes converts the communities into path attributes.
+func (c *Communities) PathAttributes() (pattr []bgp.PathAttributeInterface) {
+	if len(c.Standard) > 0 {
+		pattr = append(pattr, bgp.NewPathAttributeCommunities(c.Standard))
+	}
+	if len(c.Extended) > 0 {
+		pattr = append(pattr, bgp.NewPathAttributeExtendedCommunities(c.Extended))
+	}
+	if len(c.Large) > 0 {
+		pattr = append(pattr, bgp.NewPathAttributeLargeCommunities(c.Large))
+	}
+	return pattr
+}
+
+func parseStandardCommunity(s string) (uint32, error) {
+	for community, name := range bgp.WellKnownCommunityNameMap {
+		if s == name {
+			return uint32(community), nil
+		}
+	}
+
+	asn, value, found := strings.Cut(s, ":")
+	if !found {
+		return 0, fmt.Errorf("invalid community %q: expected <asn>:<value> or a well-known community", s)
+	}
+	high, err := strconv.ParseUint(asn, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid community %q: %s", s, err)
+	}
+	low, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid community %q: %s", s, err)
+	}
+	return uint32(high<<16 | low), nil
+}
+
+func splitList(s string) (items []string) {
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"fmt"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AnnotationPriority decides which service a prefix is announced for if
+	// several services claim it. Higher priorities win, the default is 0.
+	AnnotationPriority = "parrot.sap.cc/priority"
+)
+
+// ConflictError is returned if a route loses its prefix to the route of
+// another owner, e.g. if two services share an external IP.
+type ConflictError struct {
+	Route  RouteInterface
+	Winner RouteInterface
+}
+
+func (e *ConflictError) Error() string {
+	prefix, length := e.Route.Source()
+	return fmt.Sprintf("prefix %s/%d of %s is claimed by %s, too, which takes precedence", prefix, length, routeOwner(e.Route), routeOwner(e.Winner))
+}
+
+// RouteService returns the service a route belongs to, or nil.
+func RouteService(route RouteInterface) *v1.Service {
+	switch r := route.(type) {
+	case ExternalIPRoute:
+		return r.Service
+	case LoadBalancerIPRoute:
+		return r.Service
+	}
+	return nil
+}
+
+// ServicePriority returns the priority of a service's claims on prefixes.
+func ServicePriority(svc *v1.Service) (int, error) {
+	value, ok := svc.Annotations[AnnotationPriority]
+	if !ok {
+		return 0, nil
+	}
+
+	priority, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %s", AnnotationPriority, value, err)
+	}
+	return priority, nil
+}
+
+// Conflicts returns the number of prefixes claimed by more than one owner.
+func (s *Server) Conflicts() (conflicts int) {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	registries := map[*claimRegistry]bool{}
+	for _, store := range s.stores() {
+		if registries[store.claims] {
+			continue
+		}
+		registries[store.claims] = true
+
+		for _, claims := range store.claims.claims {
+			owners := map[string]bool{}
+			for _, c := range claims {
+				owners[routeOwner(c.route)] = true
+			}
+			if len(owners) > 1 {
+				conflicts++
+			}
+		}
+	}
+	return conflicts
+}
+
+// claimRegistry holds the claims of all owners on a prefix, across the
+// stores that announce the same prefixes, e.g. the /32 and /128 prefixes of
+// services. Only the store of the claim taking precedence announces the
+// prefix.
+type claimRegistry struct {
+	stores []*RoutesStore
+	// claims holds the claims on a prefix by claimant.
+	claims map[string]map[string]claim
+}
+
+type claim struct {
+	route RouteInterface
+	store *RoutesStore
+}
+
+func newClaimRegistry() *claimRegistry {
+	return &claimRegistry{claims: map[string]map[string]claim{}}
+}
+
+// winner returns the claim on a prefix that takes precedence. The caller
+// must hold the routes lock.
+func (r *claimRegistry) winner(key string) (winner claim) {
+	for _, c := range r.claims[key] {
+		if winner.route == nil || precedes(c.route, winner.route) {
+			winner = c
+		}
+	}
+	return winner
+}
+
+// claimant identifies a claim. An owner, like a service having the same IP
+// as external and ingress IP, might claim a prefix with several kinds of
+// routes.
+func claimant(route RouteInterface) string {
+	return fmt.Sprintf("%s %T", routeOwner(route), route)
+}
+
+// routeOwner identifies what a route is announced for.
+func routeOwner(route RouteInterface) string {
+	switch r := route.(type) {
+	case ExternalIPRoute:
+		return "service " + r.Service.Namespace + "/" + r.Service.Name
+	case LoadBalancerIPRoute:
+		return "service " + r.Service.Namespace + "/" + r.Service.Name
+	case NodePodSubnetRoute:
+		return "node " + r.Node.Name
+	}
+	return ""
+}
+
+// precedes checks whether route a wins a prefix over route b. Services with
+// a higher priority win, then the oldest one. Ties are broken by the owner's
+// name, so all nodes decide the same way.
+func precedes(a, b RouteInterface) bool {
+	svcA, svcB := RouteService(a), RouteService(b)
+	if svcA != nil && svcB != nil {
+		priorityA, _ := ServicePriority(svcA)
+		priorityB, _ := ServicePriority(svcB)
+		if priorityA != priorityB {
+			return priorityA > priorityB
+		}
+
+		createdA, createdB := svcA.CreationTimestamp, svcB.CreationTimestamp
+		if !createdA.Equal(&createdB) {
+			return createdA.Before(&createdB)
+		}
+	}
+	if ownerA, ownerB := routeOwner(a), routeOwner(b); ownerA != ownerB {
+		return ownerA < ownerB
+	}
+	return claimant(a) < claimant(b)
+}
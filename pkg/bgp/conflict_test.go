@@ -0,0 +1,179 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testService creates a service with a MED of its own, so its announcements
+// can be told apart from those of other services.
+func testService(name string, created int64, med string) *v1.Service {
+	return &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace:         "default",
+		Name:              name,
+		CreationTimestamp: metav1.NewTime(time.Unix(created, 0)),
+		Annotations:       map[string]string{AnnotationMED: med},
+	}}
+}
+
+// announcedFor returns the services the prefixes are announced for.
+func announcedFor(s *MemorySpeaker) (services []string) {
+	for _, route := range s.Routes() {
+		services = append(services, RouteService(route.RouteInterface).Name)
+	}
+	return services
+}
+
+// announcing returns the number of routes a store announces. List also
+// returns the routes that lost their prefix to another owner.
+func announcing(s RoutesStore) int {
+	return len(s.Store.List())
+}
+
+func TestOldestServiceWins(t *testing.T) {
+	hostIP := net.ParseIP("10.0.0.1")
+	older, newer := testService("older", 100, "10"), testService("newer", 200, "20")
+
+	for _, olderFirst := range []bool{true, false} {
+		speaker := NewMemorySpeaker(true)
+		server := NewServer(speaker, &hostIP, 65000, 65000)
+
+		first, second := older, newer
+		if !olderFirst {
+			first, second = newer, older
+		}
+		if err := server.ExternalIPRoutes.Add(first, "1.2.3.4", &hostIP, false); err != nil {
+			t.Fatal(err)
+		}
+		var conflict *ConflictError
+		if err := server.ExternalIPRoutes.Add(second, "1.2.3.4", &hostIP, false); !errors.As(err, &conflict) {
+			t.Errorf("older first: %t: expected a conflict, got %v", olderFirst, err)
+		} else if RouteService(conflict.Winner).Name != "older" || RouteService(conflict.Route).Name != "newer" {
+			t.Errorf("older first: %t: conflict reports %s winning over %s", olderFirst, routeOwner(conflict.Winner), routeOwner(conflict.Route))
+		}
+
+		if got := announcedFor(speaker); len(got) != 1 || got[0] != "older" {
+			t.Errorf("older first: %t: announced for %v, expected [older]", olderFirst, got)
+		}
+		if n := announcing(server.ExternalIPRoutes.store); n != 1 {
+			t.Errorf("older first: %t: %d routes announced by the store, expected 1", olderFirst, n)
+		}
+		if n := len(server.ExternalIPRoutes.List()); n != 2 {
+			t.Errorf("older first: %t: %d routes listed, expected both claims", olderFirst, n)
+		}
+		if conflicts := server.Conflicts(); conflicts != 1 {
+			t.Errorf("older first: %t: %d conflicts, expected 1", olderFirst, conflicts)
+		}
+	}
+}
+
+func TestHandoverBetweenStores(t *testing.T) {
+	hostIP := net.ParseIP("10.0.0.1")
+	external, loadBalancer := testService("external", 100, "10"), testService("loadbalancer", 200, "20")
+
+	speaker := NewMemorySpeaker(true)
+	server := NewServer(speaker, &hostIP, 65000, 65000)
+
+	if err := server.LoadBalancerIPRoutes.Add(loadBalancer, "1.2.3.4", &hostIP, false); err != nil {
+		t.Fatal(err)
+	}
+	// The older service takes the prefix over from the store of ingress IPs.
+	speaker.ResetCalls()
+	var conflict *ConflictError
+	if err := server.ExternalIPRoutes.Add(external, "1.2.3.4", &hostIP, false); !errors.As(err, &conflict) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	if got := announcedFor(speaker); len(got) != 1 || got[0] != "external" {
+		t.Errorf("announced for %v, expected [external]", got)
+	}
+	if announcing(server.ExternalIPRoutes.store) != 1 || announcing(server.LoadBalancerIPRoutes.store) != 0 {
+		t.Errorf("expected the route to move to the store of external IPs, got %d external and %d ingress IP routes",
+			announcing(server.ExternalIPRoutes.store), announcing(server.LoadBalancerIPRoutes.store))
+	}
+	if len(server.LoadBalancerIPRoutes.List()) != 1 {
+		t.Error("expected the losing claim to be listed by the store of ingress IPs")
+	}
+	for _, call := range speaker.Calls() {
+		if call.Withdraw {
+			t.Errorf("expected the announcement to be replaced, got %s", call)
+		}
+	}
+
+	// Once the winner is deleted, the prefix is handed back to the store
+	// of ingress IPs without withdrawing it.
+	speaker.ResetCalls()
+	route := server.ExternalIPRoutes.List()[0]
+	if err := server.ExternalIPRoutes.Delete(route); err != nil {
+		t.Fatal(err)
+	}
+	if got := announcedFor(speaker); len(got) != 1 || got[0] != "loadbalancer" {
+		t.Errorf("announced for %v after deleting the winner, expected [loadbalancer]", got)
+	}
+	if announcing(server.ExternalIPRoutes.store) != 0 || announcing(server.LoadBalancerIPRoutes.store) != 1 {
+		t.Errorf("expected the route to move back to the store of ingress IPs, got %d external and %d ingress IP routes",
+			announcing(server.ExternalIPRoutes.store), announcing(server.LoadBalancerIPRoutes.store))
+	}
+	if len(server.ExternalIPRoutes.List()) != 0 {
+		t.Error("expected the deleted claim not to be listed anymore")
+	}
+	for _, call := range speaker.Calls() {
+		if call.Withdraw {
+			t.Errorf("expected the announcement to be replaced, got %s", call)
+		}
+	}
+	if conflicts := server.Conflicts(); conflicts != 0 {
+		t.Errorf("%d conflicts, expected none", conflicts)
+	}
+
+	// Deleting the claim of the loser of a conflict keeps the winner.
+	if err := server.ExternalIPRoutes.Add(external, "1.2.3.4", &hostIP, false); !errors.As(err, &conflict) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	if err := server.LoadBalancerIPRoutes.Delete(NewLoadBalancerIPRoute(loadBalancer, "1.2.3.4", &hostIP, false).(LoadBalancerIPRoute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := announcedFor(speaker); len(got) != 1 || got[0] != "external" {
+		t.Errorf("announced for %v after deleting the loser, expected [external]", got)
+	}
+
+	if err := server.ExternalIPRoutes.Delete(server.ExternalIPRoutes.List()[0]); err != nil {
+		t.Fatal(err)
+	}
+	if got := speaker.Announced(); len(got) != 0 {
+		t.Errorf("announced %v after deleting all claims", got)
+	}
+}
+
+func TestSameServiceClaimsWithBothStores(t *testing.T) {
+	hostIP := net.ParseIP("10.0.0.1")
+	svc := testService("a", 100, "10")
+
+	speaker := NewMemorySpeaker(true)
+	server := NewServer(speaker, &hostIP, 65000, 65000)
+
+	if err := server.ExternalIPRoutes.Add(svc, "1.2.3.4", &hostIP, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.LoadBalancerIPRoutes.Add(svc, "1.2.3.4", &hostIP, false); err != nil {
+		t.Errorf("expected no conflict of a service with itself, got %s", err)
+	}
+	if conflicts := server.Conflicts(); conflicts != 0 {
+		t.Errorf("%d conflicts, expected none", conflicts)
+	}
+
+	// The prefix stays announced while the service still claims it.
+	if err := server.ExternalIPRoutes.Delete(NewExternalIPRoute(svc, "1.2.3.4", &hostIP, false).(ExternalIPRoute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := announcedFor(speaker); len(got) != 1 || got[0] != "a" {
+		t.Errorf("announced for %v, expected [a]", got)
+	}
+}
@@ -0,0 +1,548 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/golang/glog"
+	"github.com/osrg/gobgp/packet/bgp"
+	"github.com/sapcc/kube-parrot/pkg/util"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	DaemonFRR  = "frr"
+	DaemonBIRD = "bird"
+
+	// daemonReloadDelay batches changes, so the daemon isn't reloaded for
+	// every single route.
+	daemonReloadDelay = 1 * time.Second
+	// daemonMaxRetryDelay bounds the backoff of retrying failed reloads.
+	daemonMaxRetryDelay = 1 * time.Minute
+	// daemonPollInterval is how often the session states are polled to
+	// notice changes.
+	daemonPollInterval = 10 * time.Second
+	daemonTimeout      = 30 * time.Second
+)
+
+// DaemonOptions configure the routing daemon a DaemonSpeaker drives.
+type DaemonOptions struct {
+	// Daemon is frr or bird.
+	Daemon string
+	// ConfigPath is where the rendered configuration is written to. It
+	// defaults to the daemon's usual location.
+	ConfigPath string
+	// ReloadCommand makes the daemon apply the configuration. By default,
+	// the daemon is reloaded its usual way.
+	ReloadCommand []string
+}
+
+// DaemonSpeaker announces routes with an external routing daemon, e.g. on
+// nodes that already run one. parrot renders the BGP configuration of the
+// daemon and reloads it whenever neighbors or routes change.
+type DaemonSpeaker struct {
+	options DaemonOptions
+	daemon  daemon
+
+	mu        sync.Mutex
+	global    GlobalConfig
+	neighbors map[string]*daemonNeighbor
+	routes    map[string]Route
+	// ready is set once the first neighbor was added. Until then, the
+	// configuration isn't rendered, so a restarting parrot doesn't tear
+	// down the sessions of the daemon.
+	ready  bool
+	reload *time.Timer
+	// retrying is set while reload is the backoff of a failed reload.
+	// failures counts the failed reloads since the last successful one,
+	// which failed with lastErr.
+	retrying bool
+	failures int
+	lastErr  error
+
+	watchers []func(Peer)
+	states   map[string]string
+	stop     chan struct{}
+}
+
+// daemon renders the configuration of a specific routing daemon and
+// queries its state.
+type daemon interface {
+	defaultConfigPath() string
+	// validate rejects neighbors that can't be rendered safely, e.g.
+	// because their description would break out of its line or string.
+	validate(n *daemonNeighbor) error
+	render(w io.Writer, config daemonConfig) error
+	reload(path string) error
+	reset(address string) error
+	peers(neighbors []*daemonNeighbor) ([]Peer, error)
+}
+
+// daemonConfig is what the configuration is rendered from.
+type daemonConfig struct {
+	Global    GlobalConfig
+	Neighbors []*daemonNeighbor
+	Routes    []daemonRoute
+}
+
+type daemonNeighbor struct {
+	util.Neighbor
+	PeerAS   uint32
+	Password string
+	// Shutdown disables the session. Message is sent with the CEASE
+	// notification.
+	Shutdown bool
+	Message  string
+}
+
+// IPv4 checks whether the IPv4 unicast family is negotiated.
+func (n daemonNeighbor) IPv4() bool {
+	return n.hasFamily("ipv4-unicast")
+}
+
+// IPv6 checks whether the IPv6 unicast family is negotiated.
+func (n daemonNeighbor) IPv6() bool {
+	return n.hasFamily("ipv6-unicast")
+}
+
+func (n daemonNeighbor) hasFamily(family string) bool {
+	for _, f := range n.GetFamilies() {
+		if f == family {
+			return true
+		}
+	}
+	return false
+}
+
+// Name is a name for the neighbor that only contains letters, digits and
+// underscores.
+func (n daemonNeighbor) Name() string {
+	return "parrot_" + strings.NewReplacer(".", "_", ":", "_").Replace(n.Address)
+}
+
+// daemonRoute is a route with its path attributes in their textual form.
+type daemonRoute struct {
+	Name             string
+	Prefix           string
+	IPv6             bool
+	NextHop          string
+	Communities      []string
+	ExtCommunities   []string
+	LargeCommunities []string
+	MED              *uint32
+	LocalPref        *uint32
+	Prepend          []uint32
+}
+
+func NewDaemonSpeaker(options DaemonOptions) (*DaemonSpeaker, error) {
+	var d daemon
+	switch options.Daemon {
+	case DaemonFRR:
+		d = frr{}
+	case DaemonBIRD:
+		d = bird{}
+	default:
+		return nil, fmt.Errorf("unknown routing daemon %q", options.Daemon)
+	}
+
+	if options.ConfigPath == "" {
+		options.ConfigPath = d.defaultConfigPath()
+	}
+
+	return &DaemonSpeaker{
+		options:   options,
+		daemon:    d,
+		neighbors: map[string]*daemonNeighbor{},
+		routes:    map[string]Route{},
+		states:    map[string]string{},
+		stop:      make(chan struct{}),
+	}, nil
+}
+
+func (s *DaemonSpeaker) Start(global GlobalConfig) error {
+	s.mu.Lock()
+	s.global = global
+	s.mu.Unlock()
+
+	go wait.Until(s.poll, daemonPollInterval, s.stop)
+	return nil
+}
+
+// Stop stops managing the daemon. The daemon keeps running with the last
+// rendered configuration.
+func (s *DaemonSpeaker) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reload != nil {
+		s.reload.Stop()
+		s.reload = nil
+	}
+	close(s.stop)
+}
+
+func (s *DaemonSpeaker) AddNeighbor(neighbor util.Neighbor, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := &daemonNeighbor{Neighbor: neighbor, PeerAS: s.global.peerAS(neighbor), Password: password}
+	if err := s.daemon.validate(n); err != nil {
+		return fmt.Errorf("can't configure neighbor %s with %s: %s", neighbor.Address, s.options.Daemon, err)
+	}
+	s.neighbors[neighbor.Address] = n
+	s.ready = true
+	s.scheduleReload()
+	return nil
+}
+
+func (s *DaemonSpeaker) UpdateNeighbor(neighbor util.Neighbor, password string) error {
+	return s.AddNeighbor(neighbor, password)
+}
+
+func (s *DaemonSpeaker) RemoveNeighbor(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.neighbors, address)
+	s.scheduleReload()
+	return nil
+}
+
+func (s *DaemonSpeaker) ResetNeighbor(address, reason string) error {
+	return s.daemon.reset(address)
+}
+
+// ShutdownNeighbor disables the session right away.
+func (s *DaemonSpeaker) ShutdownNeighbor(address, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.neighbors[address]
+	if !ok {
+		return fmt.Errorf("unknown neighbor %s", address)
+	}
+	n.Shutdown, n.Message = true, singleLine(reason)
+
+	if s.reload != nil {
+		s.reload.Stop()
+	}
+	return s.applyOrRetry()
+}
+
+func (s *DaemonSpeaker) Announce(route Route) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, _ := RouteKeyFunc(route.RouteInterface)
+	s.routes[key] = route
+	s.scheduleReload()
+	return nil
+}
+
+func (s *DaemonSpeaker) Withdraw(route Route) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, _ := RouteKeyFunc(route.RouteInterface)
+	delete(s.routes, key)
+	s.scheduleReload()
+	return nil
+}
+
+func (s *DaemonSpeaker) Peers() ([]Peer, error) {
+	s.mu.Lock()
+	neighbors := s.neighborList()
+	s.mu.Unlock()
+
+	return s.daemon.peers(neighbors)
+}
+
+// WatchPeers calls f for changes noticed while polling the daemon.
+func (s *DaemonSpeaker) WatchPeers(f func(Peer)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.watchers = append(s.watchers, f)
+}
+
+func (s *DaemonSpeaker) poll() {
+	peers, err := s.Peers()
+	if err != nil {
+		glog.V(3).Infof("Couldn't get session states from %s: %s", s.options.Daemon, err)
+		return
+	}
+
+	s.mu.Lock()
+	var changed []Peer
+	for _, peer := range peers {
+		if s.states[peer.Address] != peer.State {
+			s.states[peer.Address] = peer.State
+			changed = append(changed, peer)
+		}
+	}
+	watchers := s.watchers
+	s.mu.Unlock()
+
+	for _, peer := range changed {
+		for _, f := range watchers {
+			f(peer)
+		}
+	}
+}
+
+// Healthy returns why the last reload of the daemon failed. Announcements
+// and withdrawals haven't reached the daemon meanwhile. It returns nil once
+// a reload succeeded again.
+func (s *DaemonSpeaker) Healthy() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastErr
+}
+
+// scheduleReload applies the configuration after the reload delay. A change
+// retries a failed reload right away, instead of waiting for its backoff.
+// The caller must hold the lock.
+func (s *DaemonSpeaker) scheduleReload() {
+	if !s.ready {
+		return
+	}
+	if s.reload != nil {
+		if !s.retrying || !s.reload.Stop() {
+			return
+		}
+	}
+
+	s.retrying = false
+	s.reload = time.AfterFunc(daemonReloadDelay, s.scheduledReload)
+}
+
+func (s *DaemonSpeaker) scheduledReload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+	s.applyOrRetry()
+}
+
+// applyOrRetry applies the configuration. If that fails, it is retried with
+// an exponential backoff until it succeeds. The caller must hold the lock.
+func (s *DaemonSpeaker) applyOrRetry() error {
+	err := s.apply()
+	if err == nil {
+		if s.failures > 0 {
+			glog.Infof("Reloaded %s after %d failed attempts", s.options.Daemon, s.failures)
+		}
+		s.failures, s.lastErr = 0, nil
+		return nil
+	}
+
+	s.failures++
+	s.lastErr = err
+	delay := daemonMaxRetryDelay
+	if s.failures < 7 {
+		delay = min(daemonReloadDelay<<s.failures, daemonMaxRetryDelay)
+	}
+	glog.Errorf("Oops. Something went wrong reloading %s: %s. Retrying in %s", s.options.Daemon, err, delay)
+
+	s.retrying = true
+	s.reload = time.AfterFunc(delay, s.scheduledReload)
+	return err
+}
+
+// apply renders the configuration and reloads the daemon. The caller must
+// hold the lock.
+func (s *DaemonSpeaker) apply() error {
+	s.reload = nil
+
+	config := daemonConfig{Global: s.global, Neighbors: s.neighborList()}
+	for _, route := range s.routes {
+		r, err := newDaemonRoute(route)
+		if err != nil {
+			glog.Errorf("Not rendering %s: %s", route, err)
+			continue
+		}
+		config.Routes = append(config.Routes, r)
+	}
+	sort.Slice(config.Routes, func(i, j int) bool { return config.Routes[i].Name < config.Routes[j].Name })
+
+	buf := &bytes.Buffer{}
+	if err := s.daemon.render(buf, config); err != nil {
+		return fmt.Errorf("couldn't render config: %s", err)
+	}
+
+	// The config is replaced atomically, so the daemon never reads a
+	// partially written one.
+	tmp, err := os.CreateTemp(filepath.Dir(s.options.ConfigPath), ".parrot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0640); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.options.ConfigPath); err != nil {
+		return err
+	}
+
+	glog.V(2).Infof("Reloading %s with %d neighbors and %d routes", s.options.Daemon, len(config.Neighbors), len(config.Routes))
+	if len(s.options.ReloadCommand) > 0 {
+		_, err = runDaemonCommand(s.options.ReloadCommand...)
+		return err
+	}
+	return s.daemon.reload(s.options.ConfigPath)
+}
+
+// neighborList returns the neighbors ordered by address. The caller must
+// hold the lock.
+func (s *DaemonSpeaker) neighborList() (neighbors []*daemonNeighbor) {
+	for _, n := range s.neighbors {
+		neighbors = append(neighbors, n)
+	}
+	sort.Slice(neighbors, func(i, j int) bool { return neighbors[i].Address < neighbors[j].Address })
+	return neighbors
+}
+
+// validateLine rejects neighbor settings containing control characters,
+// which would end the line they are rendered to.
+func validateLine(n *daemonNeighbor) error {
+	for name, value := range map[string]string{"password": n.Password, "description": n.Description} {
+		if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return fmt.Errorf("%s must not contain control characters like newlines", name)
+		}
+	}
+	return nil
+}
+
+// singleLine replaces control characters, so free text like a shutdown
+// message can be rendered to a single line.
+func singleLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+func newDaemonRoute(route Route) (daemonRoute, error) {
+	prefix, length := route.Source()
+	if prefix == nil || route.NextHop() == nil {
+		return daemonRoute{}, fmt.Errorf("invalid prefix or next hop")
+	}
+	attrs := route.EffectiveAttributes()
+
+	r := daemonRoute{
+		Prefix:    fmt.Sprintf("%s/%d", prefix, length),
+		IPv6:      RouteFamily(*prefix) == bgp.RF_IPv6_UC,
+		NextHop:   route.NextHop().String(),
+		MED:       attrs.MED,
+		LocalPref: attrs.LocalPref,
+	}
+	r.Name = "parrot_" + strings.NewReplacer(".", "_", ":", "_", "/", "_").Replace(r.Prefix)
+
+	for i := uint8(0); i < attrs.Prepend; i++ {
+		r.Prepend = append(r.Prepend, route.LocalAS)
+	}
+
+	if c := attrs.Communities; c != nil {
+		for _, community := range c.Standard {
+			r.Communities = append(r.Communities, fmt.Sprintf("%d:%d", community>>16, community&0xffff))
+		}
+		for _, community := range c.Extended {
+			_, subtype := community.GetTypes()
+			switch subtype {
+			case bgp.EC_SUBTYPE_ROUTE_TARGET:
+				r.ExtCommunities = append(r.ExtCommunities, "rt "+community.String())
+			case bgp.EC_SUBTYPE_ROUTE_ORIGIN:
+				r.ExtCommunities = append(r.ExtCommunities, "soo "+community.String())
+			default:
+				return daemonRoute{}, fmt.Errorf("extended community %s isn't supported", community)
+			}
+		}
+		for _, community := range c.Large {
+			r.LargeCommunities = append(r.LargeCommunities, community.String())
+		}
+	}
+
+	return r, nil
+}
+
+var daemonTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"seconds": func(d time.Duration) int {
+		return int(d.Seconds())
+	},
+	// timers returns keepalive interval and hold time, deriving the one
+	// that isn't set from the other like the daemons' defaults do.
+	"timers": func(keepalive, hold uint32) string {
+		if hold == 0 {
+			hold = 3 * keepalive
+		}
+		if keepalive == 0 {
+			keepalive = hold / 3
+		}
+		return fmt.Sprintf("%d %d", keepalive, hold)
+	},
+	"families": func() []string {
+		return []string{"ipv4", "ipv6"}
+	},
+	"family": func(ipv6 bool) string {
+		if ipv6 {
+			return "ipv6"
+		}
+		return "ipv4"
+	},
+	// birdPair turns "65000:100" into "65000,100".
+	"birdPair": func(s string) string {
+		return strings.ReplaceAll(s, ":", ",")
+	},
+	// birdExtended turns "rt 65000:100" into "rt,65000,100".
+	"birdExtended": func(s string) string {
+		kind, value, _ := strings.Cut(s, " ")
+		i := strings.LastIndex(value, ":")
+		return kind + "," + value[:i] + "," + value[i+1:]
+	},
+}
+
+func runDaemonCommand(command ...string) ([]byte, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), daemonTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %s: %s", strings.Join(command, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// bird renders a BIRD 2 configuration snippet, which is meant to be
+// included from bird.conf. Routes are originated by static blackhole routes
+// in protocols named parrot_ipv4 and parrot_ipv6, which must not be exported
+// to the kernel.
+type bird struct{}
+
+var birdTemplate = template.Must(template.New("bird").Funcs(daemonTemplateFuncs).Parse(`# Rendered by kube-parrot. Changes are overwritten.
+{{- range $family := families }}
+
+protocol static parrot_{{ $family }} {
+	{{ $family }} { import all; export none; };
+{{- range $.Routes }}{{ if eq (family .IPv6) $family }}
+	route {{ .Prefix }} blackhole;
+{{- end }}{{ end }}
+}
+
+filter parrot_export_{{ $family }} {
+	if proto != "parrot_{{ $family }}" then reject;
+{{- range $.Routes }}{{ if eq (family .IPv6) $family }}
+	if net = {{ .Prefix }} then {
+		bgp_next_hop = {{ .NextHop }};
+{{- range .Communities }}
+		bgp_community.add(({{ birdPair . }}));
+{{- end }}
+{{- range .ExtCommunities }}
+		bgp_ext_community.add(({{ birdExtended . }}));
+{{- end }}
+{{- range .LargeCommunities }}
+		bgp_large_community.add(({{ birdPair . }}));
+{{- end }}
+{{- if .MED }}
+		bgp_med = {{ .MED }};
+{{- end }}
+{{- if .LocalPref }}
+		bgp_local_pref = {{ .LocalPref }};
+{{- end }}
+{{- range .Prepend }}
+		bgp_path.prepend({{ . }});
+{{- end }}
+		accept;
+	}
+{{- end }}{{ end }}
+	reject;
+}
+{{- end }}
+{{- range .Neighbors }}
+
+protocol bgp {{ .Name }} {
+{{- if .Description }}
+	description "{{ .Description }}";
+{{- end }}
+	local {{ if .LocalAddress }}{{ .LocalAddress }} {{ end }}as {{ $.Global.AS }};
+	neighbor {{ .Address }} as {{ .PeerAS }};
+{{- if .Password }}
+	password "{{ .Password }}";
+{{- end }}
+{{- if .HoldTime }}
+	hold time {{ .HoldTime }};
+{{- end }}
+{{- if .KeepaliveInterval }}
+	keepalive time {{ .KeepaliveInterval }};
+{{- end }}
+{{- if .EBGPMultihopTTL }}
+	multihop {{ .EBGPMultihopTTL }};
+{{- end }}
+{{- if .Passive }}
+	passive on;
+{{- end }}
+{{- if .Shutdown }}
+	disabled yes;
+{{- end }}
+{{- if $.Global.GracefulRestartTime }}
+	graceful restart on;
+	graceful restart time {{ seconds $.Global.GracefulRestartTime }};
+{{- if $.Global.LongLivedGracefulRestartTime }}
+	long lived graceful restart on;
+	long lived stale time {{ seconds $.Global.LongLivedGracefulRestartTime }};
+{{- end }}
+{{- end }}
+{{- if .IPv4 }}
+	ipv4 { import none; export filter parrot_export_ipv4; next hop keep; };
+{{- end }}
+{{- if .IPv6 }}
+	ipv6 { import none; export filter parrot_export_ipv6; next hop keep; };
+{{- end }}
+}
+{{- end }}
+`))
+
+func (bird) defaultConfigPath() string {
+	return "/etc/bird/parrot.conf"
+}
+
+// validate rejects quotes and backslashes, as BIRD doesn't support escaping
+// them in strings.
+func (bird) validate(n *daemonNeighbor) error {
+	if err := validateLine(n); err != nil {
+		return err
+	}
+	for name, value := range map[string]string{"password": n.Password, "description": n.Description} {
+		if strings.ContainsAny(value, `"\`) {
+			return fmt.Errorf("%s must not contain quotes or backslashes", name)
+		}
+	}
+	return nil
+}
+
+func (bird) render(w io.Writer, config daemonConfig) error {
+	return birdTemplate.Execute(w, config)
+}
+
+func (bird) reload(path string) error {
+	_, err := runDaemonCommand("birdc", "configure")
+	return err
+}
+
+func (bird) reset(address string) error {
+	n := daemonNeighbor{}
+	n.Address = address
+	_, err := runDaemonCommand("birdc", "restart", n.Name())
+	return err
+}
+
+var birdStates = map[string]bool{
+	"idle": true, "connect": true, "active": true, "opensent": true, "openconfirm": true, "established": true,
+}
+
+// peers parses the output of "birdc show protocols", e.g.
+//
+//	Name            Proto  Table  State  Since     Info
+//	parrot_10_0_0_1 BGP    ---    up     12:00:00  Established
+func (bird) peers(neighbors []*daemonNeighbor) ([]Peer, error) {
+	out, err := runDaemonCommand("birdc", "show", "protocols")
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[1] != "BGP" {
+			continue
+		}
+		// Depending on the time format, Since spans one or two fields.
+		for _, field := range fields[2:] {
+			if state := strings.ToLower(field); birdStates[state] {
+				states[fields[0]] = state
+				break
+			}
+		}
+	}
+
+	var peers []Peer
+	for _, n := range neighbors {
+		state, ok := states[n.Name()]
+		if !ok {
+			continue
+		}
+		peers = append(peers, Peer{Address: n.Address, State: state})
+	}
+	return peers, nil
+}
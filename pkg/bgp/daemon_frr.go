@@ -0,0 +1,217 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/osrg/gobgp/packet/bgp"
+)
+
+// frr renders a fragment of FRR's configuration with the router bgp stanza
+// of the local AS and the route maps of the routes. FRR can't include
+// files, so on reload, the fragment is appended to frr.conf, which must not
+// configure the local AS itself, and the result is diffed against the
+// running configuration by frr-reload.py. Routes are originated with
+// network statements, so they don't need to be in the RIB.
+type frr struct{}
+
+const (
+	frrConfigPath = "/etc/frr/frr.conf"
+	frrReloadPath = "/usr/lib/frr/frr-reload.py"
+)
+
+var frrTemplate = template.Must(template.New("frr").Funcs(daemonTemplateFuncs).Parse(`! Rendered by kube-parrot. Changes are overwritten.
+router bgp {{ .Global.AS }}
+ bgp router-id {{ .Global.RouterID }}
+ no bgp default ipv4-unicast
+ no bgp ebgp-requires-policy
+ no bgp network import-check
+{{- if .Global.GracefulRestartTime }}
+ bgp graceful-restart
+ bgp graceful-restart restart-time {{ seconds .Global.GracefulRestartTime }}
+{{- if .Global.LongLivedGracefulRestartTime }}
+ bgp long-lived-graceful-restart stale-time {{ seconds .Global.LongLivedGracefulRestartTime }}
+{{- end }}
+{{- end }}
+{{- range .Neighbors }}
+ neighbor {{ .Address }} remote-as {{ .PeerAS }}
+{{- if .Description }}
+ neighbor {{ .Address }} description {{ .Description }}
+{{- end }}
+{{- if .Password }}
+ neighbor {{ .Address }} password {{ .Password }}
+{{- end }}
+{{- if or .KeepaliveInterval .HoldTime }}
+ neighbor {{ .Address }} timers {{ timers .KeepaliveInterval .HoldTime }}
+{{- end }}
+{{- if .EBGPMultihopTTL }}
+ neighbor {{ .Address }} ebgp-multihop {{ .EBGPMultihopTTL }}
+{{- end }}
+{{- if .LocalAddress }}
+ neighbor {{ .Address }} update-source {{ .LocalAddress }}
+{{- end }}
+{{- if .Passive }}
+ neighbor {{ .Address }} passive
+{{- end }}
+{{- if .Shutdown }}
+ neighbor {{ .Address }} shutdown message {{ .Message }}
+{{- end }}
+{{- end }}
+ !
+ address-family ipv4 unicast
+{{- range .Routes }}{{ if not .IPv6 }}
+  network {{ .Prefix }} route-map {{ .Name }}
+{{- end }}{{ end }}
+{{- range .Neighbors }}{{ if .IPv4 }}
+  neighbor {{ .Address }} activate
+{{- end }}{{ end }}
+ exit-address-family
+ !
+ address-family ipv6 unicast
+{{- range .Routes }}{{ if .IPv6 }}
+  network {{ .Prefix }} route-map {{ .Name }}
+{{- end }}{{ end }}
+{{- range .Neighbors }}{{ if .IPv6 }}
+  neighbor {{ .Address }} activate
+{{- end }}{{ end }}
+ exit-address-family
+exit
+!
+{{- range .Routes }}
+route-map {{ .Name }} permit 10
+{{- if .IPv6 }}
+ set ipv6 next-hop global {{ .NextHop }}
+{{- else }}
+ set ip next-hop {{ .NextHop }}
+{{- end }}
+{{- if .Communities }}
+ set community {{ join .Communities " " }} additive
+{{- end }}
+{{- range .ExtCommunities }}
+ set extcommunity {{ . }}
+{{- end }}
+{{- if .LargeCommunities }}
+ set large-community {{ join .LargeCommunities " " }} additive
+{{- end }}
+{{- if .MED }}
+ set metric {{ .MED }}
+{{- end }}
+{{- if .LocalPref }}
+ set local-preference {{ .LocalPref }}
+{{- end }}
+{{- if .Prepend }}
+ set as-path prepend {{ range $i, $as := .Prepend }}{{ if $i }} {{ end }}{{ $as }}{{ end }}
+{{- end }}
+exit
+!
+{{- end }}
+`))
+
+func (frr) defaultConfigPath() string {
+	return "/etc/frr/parrot.conf"
+}
+
+// validate rejects passwords FRR would read as several words.
+func (frr) validate(n *daemonNeighbor) error {
+	if err := validateLine(n); err != nil {
+		return err
+	}
+	if strings.IndexFunc(n.Password, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("password must not contain whitespace")
+	}
+	return nil
+}
+
+func (frr) render(w io.Writer, config daemonConfig) error {
+	return frrTemplate.Execute(w, config)
+}
+
+// reload appends the fragment to frr.conf and lets frr-reload.py apply the
+// result. Stanzas parrot rendered before, but not anymore, are removed that
+// way, while the rest of the running configuration stays untouched.
+func (frr) reload(path string) error {
+	base, err := os.ReadFile(frrConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fragment, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	merged, err := os.CreateTemp(filepath.Dir(path), ".parrot-merged-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(merged.Name())
+	for _, b := range [][]byte{base, []byte("\n"), fragment} {
+		if _, err := merged.Write(b); err != nil {
+			merged.Close()
+			return err
+		}
+	}
+	if err := merged.Close(); err != nil {
+		return err
+	}
+
+	_, err = runDaemonCommand(frrReloadPath, "--reload", merged.Name())
+	return err
+}
+
+func (frr) reset(address string) error {
+	_, err := runDaemonCommand("vtysh", "-c", "clear bgp "+address)
+	return err
+}
+
+// frrNeighbor is the part of vtysh's "show bgp neighbors json" output that
+// is used.
+type frrNeighbor struct {
+	BGPState          string `json:"bgpState"`
+	AddressFamilyInfo map[string]struct {
+		SentPrefixCounter int `json:"sentPrefixCounter"`
+	} `json:"addressFamilyInfo"`
+}
+
+var frrFamilies = map[string]bgp.RouteFamily{
+	"ipv4Unicast": bgp.RF_IPv4_UC,
+	"ipv6Unicast": bgp.RF_IPv6_UC,
+}
+
+func (frr) peers(neighbors []*daemonNeighbor) ([]Peer, error) {
+	out, err := runDaemonCommand("vtysh", "-c", "show bgp neighbors json")
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]frrNeighbor{}
+	if err := json.Unmarshal(out, &states); err != nil {
+		return nil, err
+	}
+
+	var peers []Peer
+	for _, n := range neighbors {
+		state, ok := states[n.Address]
+		if !ok {
+			continue
+		}
+
+		peer := Peer{Address: n.Address, State: strings.ToLower(state.BGPState), AdvertisedPrefixes: map[bgp.RouteFamily]int{}}
+		for name, info := range state.AddressFamilyInfo {
+			if family, ok := frrFamilies[name]; ok {
+				peer.AdvertisedPrefixes[family] = info.SentPrefixCounter
+				peer.Advertised += uint64(info.SentPrefixCounter)
+			}
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
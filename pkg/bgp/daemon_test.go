@@ -0,0 +1,210 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sapcc/kube-parrot/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testDaemonConfig(t *testing.T) daemonConfig {
+	t.Helper()
+
+	hostIP := net.ParseIP("10.0.0.1")
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "a",
+		Annotations: map[string]string{
+			AnnotationCommunities:      "65000:100",
+			AnnotationLargeCommunities: "65000:1:2",
+			AnnotationMED:              "10",
+			AnnotationASPathPrepend:    "2",
+		},
+	}}
+	route, err := newDaemonRoute(Route{RouteInterface: NewExternalIPRoute(svc, "1.2.3.4", &hostIP, false), LocalAS: 65000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	neighbor := &daemonNeighbor{
+		Neighbor: util.Neighbor{Address: "10.0.0.254", Description: "spine 1", HoldTime: 9, Families: []string{util.FamilyIPv4Unicast}},
+		PeerAS:   65001,
+		Password: "secret",
+	}
+	return daemonConfig{
+		Global:    GlobalConfig{AS: 65000, RouterID: "10.0.0.1", GracefulRestartTime: 120 * time.Second},
+		Neighbors: []*daemonNeighbor{neighbor},
+		Routes:    []daemonRoute{route},
+	}
+}
+
+func TestDaemonRender(t *testing.T) {
+	tests := []struct {
+		daemon daemon
+		lines  []string
+	}{
+		{
+			daemon: frr{},
+			lines: []string{
+				"router bgp 65000",
+				" bgp router-id 10.0.0.1",
+				" bgp graceful-restart restart-time 120",
+				" neighbor 10.0.0.254 remote-as 65001",
+				" neighbor 10.0.0.254 description spine 1",
+				" neighbor 10.0.0.254 password secret",
+				" neighbor 10.0.0.254 timers 3 9",
+				"  network 1.2.3.4/32 route-map parrot_1_2_3_4_32",
+				"  neighbor 10.0.0.254 activate",
+				"route-map parrot_1_2_3_4_32 permit 10",
+				" set ip next-hop 10.0.0.1",
+				" set community 65000:100 additive",
+				" set large-community 65000:1:2 additive",
+				" set metric 10",
+				" set as-path prepend 65000 65000",
+			},
+		},
+		{
+			daemon: bird{},
+			lines: []string{
+				"protocol static parrot_ipv4 {",
+				"\troute 1.2.3.4/32 blackhole;",
+				"\tif net = 1.2.3.4/32 then {",
+				"\t\tbgp_next_hop = 10.0.0.1;",
+				"\t\tbgp_community.add((65000,100));",
+				"\t\tbgp_large_community.add((65000,1,2));",
+				"\t\tbgp_med = 10;",
+				"\t\tbgp_path.prepend(65000);",
+				"protocol bgp parrot_10_0_0_254 {",
+				"\tdescription \"spine 1\";",
+				"\tlocal as 65000;",
+				"\tneighbor 10.0.0.254 as 65001;",
+				"\tpassword \"secret\";",
+				"\thold time 9;",
+				"\tgraceful restart time 120;",
+				"\tipv4 { import none; export filter parrot_export_ipv4; next hop keep; };",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		buf := &bytes.Buffer{}
+		if err := tt.daemon.render(buf, testDaemonConfig(t)); err != nil {
+			t.Fatalf("%T: %s", tt.daemon, err)
+		}
+		rendered := map[string]bool{}
+		for _, line := range strings.Split(buf.String(), "\n") {
+			rendered[line] = true
+		}
+		for _, line := range tt.lines {
+			if !rendered[line] {
+				t.Errorf("%T: expected line %q in\n%s", tt.daemon, line, buf)
+			}
+		}
+		if strings.Contains(buf.String(), "\tipv6 { import none") || strings.Contains(buf.String(), "neighbor 10.0.0.254 shutdown") {
+			t.Errorf("%T: unexpected IPv6 session or shutdown in\n%s", tt.daemon, buf)
+		}
+	}
+}
+
+func TestDaemonValidateNeighbor(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		description string
+		frr, bird   bool
+	}{
+		{name: "plain", password: "secret", description: "spine 1", frr: true, bird: true},
+		{name: "newline in password", password: "secret\n neighbor 10.0.0.2 remote-as 1"},
+		{name: "newline in description", description: "spine\n}\nprotocol bgp evil {"},
+		{name: "control character", description: "spine\x00"},
+		{name: "whitespace in password", password: "two words", bird: true},
+		{name: "quote in password", password: `se"cret`, frr: true},
+		{name: "quote in description", description: `spine "1"`, frr: true},
+		{name: "backslash in description", description: `spine\`, frr: true},
+	}
+
+	for _, tt := range tests {
+		n := &daemonNeighbor{Neighbor: util.Neighbor{Address: "10.0.0.254", Description: tt.description}, Password: tt.password}
+		if err := (frr{}).validate(n); (err == nil) != tt.frr {
+			t.Errorf("%s: FRR accepts: %t, expected %t (%v)", tt.name, err == nil, tt.frr, err)
+		}
+		if err := (bird{}).validate(n); (err == nil) != tt.bird {
+			t.Errorf("%s: BIRD accepts: %t, expected %t (%v)", tt.name, err == nil, tt.bird, err)
+		}
+	}
+
+	s, err := NewDaemonSpeaker(DaemonOptions{Daemon: DaemonBIRD, ConfigPath: filepath.Join(t.TempDir(), "parrot.conf")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddNeighbor(util.Neighbor{Address: "10.0.0.254", Description: "spine\n1"}, ""); err == nil {
+		t.Error("expected AddNeighbor to reject a description with a newline")
+	}
+	if s.ShutdownNeighbor("10.0.0.254", "") == nil {
+		t.Error("expected the rejected neighbor not to be configured")
+	}
+}
+
+func TestDaemonRetriesFailedReloads(t *testing.T) {
+	dir := t.TempDir()
+	reloadable := filepath.Join(dir, "reloadable")
+	s, err := NewDaemonSpeaker(DaemonOptions{
+		Daemon:        DaemonBIRD,
+		ConfigPath:    filepath.Join(dir, "parrot.conf"),
+		ReloadCommand: []string{"sh", "-c", "test -e " + reloadable},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(GlobalConfig{AS: 65000, RouterID: "10.0.0.1", RemoteAS: 65000}); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	if err := s.AddNeighbor(util.Neighbor{Address: "10.0.0.254"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	await := func(healthy bool, timeout time.Duration) {
+		t.Helper()
+		deadline := time.Now().Add(timeout)
+		for (s.Healthy() == nil) != healthy {
+			if time.Now().After(deadline) {
+				t.Fatalf("speaker didn't become healthy: %t within %s", healthy, timeout)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+
+	// The reload fails and is retried without further changes.
+	await(false, 3*daemonReloadDelay)
+	if err := os.WriteFile(reloadable, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	await(true, 4*daemonReloadDelay)
+
+	// After many failures, the backoff is long, but the next change retries
+	// right away.
+	s.mu.Lock()
+	s.failures = 10
+	s.mu.Unlock()
+	if err := os.Remove(reloadable); err != nil {
+		t.Fatal(err)
+	}
+	s.RemoveNeighbor("10.0.0.254")
+	await(false, 3*daemonReloadDelay)
+	if err := os.WriteFile(reloadable, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s.AddNeighbor(util.Neighbor{Address: "10.0.0.254"}, "")
+	await(true, 3*daemonReloadDelay)
+}
@@ -0,0 +1,193 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/osrg/gobgp/api"
+	"github.com/osrg/gobgp/config"
+	"github.com/osrg/gobgp/packet/bgp"
+	gobgp "github.com/osrg/gobgp/server"
+	"github.com/osrg/gobgp/table"
+	"github.com/sapcc/kube-parrot/pkg/util"
+)
+
+// GoBGPSpeaker announces routes with an embedded GoBGP. Its gRPC API is
+// served, so the gobgp CLI can be used for debugging.
+type GoBGPSpeaker struct {
+	bgp    *gobgp.BgpServer
+	grpc   *api.Server
+	global GlobalConfig
+}
+
+func NewGoBGPSpeaker(grpcPort int) *GoBGPSpeaker {
+	s := &GoBGPSpeaker{bgp: gobgp.NewBgpServer()}
+	s.grpc = api.NewGrpcServer(s.bgp, fmt.Sprintf(":%v", grpcPort))
+	return s
+}
+
+func (s *GoBGPSpeaker) Start(global GlobalConfig) error {
+	// logrus.SetLevel(logrus.DebugLevel)
+
+	go s.bgp.Serve()
+	go s.grpc.Serve()
+
+	time.Sleep(1 * time.Second)
+
+	s.global = global
+	if err := s.bgp.Start(&config.Global{
+		Config: config.GlobalConfig{
+			As:       global.AS,
+			RouterId: global.RouterID,
+			Port:     -1,
+		},
+	}); err != nil {
+		return fmt.Errorf("Oops. Something went wrong starting bgp server: %s", err)
+	}
+	return nil
+}
+
+func (s *GoBGPSpeaker) Stop() {
+	s.bgp.Stop()
+}
+
+func (s *GoBGPSpeaker) AddNeighbor(neighbor util.Neighbor, password string) error {
+	if err := s.bgp.AddNeighbor(s.neighborConfig(neighbor, password)); err != nil {
+		return fmt.Errorf("Oops. Something went wrong adding neighbor: %s", err)
+	}
+	return nil
+}
+
+// UpdateNeighbor resets the session if the configuration changed.
+func (s *GoBGPSpeaker) UpdateNeighbor(neighbor util.Neighbor, password string) error {
+	_, err := s.bgp.UpdateNeighbor(s.neighborConfig(neighbor, password))
+	return err
+}
+
+func (s *GoBGPSpeaker) RemoveNeighbor(address string) error {
+	return s.bgp.DeleteNeighbor(&config.Neighbor{Config: config.NeighborConfig{NeighborAddress: address}})
+}
+
+func (s *GoBGPSpeaker) ResetNeighbor(address, reason string) error {
+	return s.bgp.ResetNeighbor(address, reason)
+}
+
+func (s *GoBGPSpeaker) ShutdownNeighbor(address, reason string) error {
+	return s.bgp.ShutdownNeighbor(address, reason)
+}
+
+func (s *GoBGPSpeaker) Announce(route Route) error {
+	if _, err := s.bgp.AddPath("", []*table.Path{route.Path(false)}); err != nil {
+		return fmt.Errorf("Oops. Something went wrong adding path: %s", err)
+	}
+	return nil
+}
+
+func (s *GoBGPSpeaker) Withdraw(route Route) error {
+	if err := s.bgp.DeletePath(nil, route.Family(), "", []*table.Path{route.Path(true)}); err != nil {
+		return fmt.Errorf("Oops. Something went wrong deleting route: %s", err)
+	}
+	return nil
+}
+
+func (s *GoBGPSpeaker) Peers() ([]Peer, error) {
+	var peers []Peer
+	for _, n := range s.bgp.GetNeighbor("", false) {
+		peer := Peer{
+			Address:            n.State.NeighborAddress,
+			State:              string(n.State.SessionState),
+			Advertised:         uint64(n.State.AdjTable.Advertised),
+			AdvertisedPrefixes: map[bgp.RouteFamily]int{},
+		}
+		if peer.Address == "" {
+			peer.Address = n.Config.NeighborAddress
+		}
+		for _, family := range []bgp.RouteFamily{bgp.RF_IPv4_UC, bgp.RF_IPv6_UC} {
+			if info, err := s.bgp.GetAdjRibInfo(peer.Address, family, false); err == nil {
+				peer.AdvertisedPrefixes[family] = info.NumDestination
+			}
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+func (s *GoBGPSpeaker) WatchPeers(f func(Peer)) {
+	w := s.bgp.Watch(gobgp.WatchPeerState(false))
+	go func() {
+		for ev := range w.Event() {
+			if state, ok := ev.(*gobgp.WatchEventPeerState); ok {
+				f(Peer{
+					Address: state.PeerAddress.String(),
+					State:   strings.ToLower(strings.TrimPrefix(state.State.String(), "BGP_FSM_")),
+				})
+			}
+		}
+	}()
+}
+
+func (s *GoBGPSpeaker) neighborConfig(neighbor util.Neighbor, password string) *config.Neighbor {
+	n := &config.Neighbor{
+		Config: config.NeighborConfig{
+			NeighborAddress: neighbor.Address,
+			PeerAs:          s.global.peerAS(neighbor),
+			Description:     neighbor.Description,
+			AuthPassword:    password,
+		},
+		Timers: config.Timers{
+			Config: config.TimersConfig{
+				HoldTime:          float64(neighbor.HoldTime),
+				KeepaliveInterval: float64(neighbor.KeepaliveInterval),
+			},
+		},
+		Transport: config.Transport{
+			Config: config.TransportConfig{
+				LocalAddress: neighbor.LocalAddress,
+				PassiveMode:  neighbor.Passive,
+			},
+		},
+		EbgpMultihop: config.EbgpMultihop{
+			Config: config.EbgpMultihopConfig{
+				Enabled:     neighbor.EBGPMultihopTTL > 0,
+				MultihopTtl: neighbor.EBGPMultihopTTL,
+			},
+		},
+	}
+
+	// Neighbors keep the routes of a gracefully restarting parrot until it
+	// sent End-of-RIB, which GoBGP does right after the initial update once
+	// the session is established. Sending a notification, e.g. on shutdown,
+	// doesn't end graceful restart either (RFC 8538).
+	restartTime, longLivedRestartTime := s.global.GracefulRestartTime, s.global.LongLivedGracefulRestartTime
+	gracefulRestart := restartTime > 0
+	if gracefulRestart {
+		n.GracefulRestart.Config = config.GracefulRestartConfig{
+			Enabled:             true,
+			RestartTime:         uint16(restartTime.Seconds()),
+			NotificationEnabled: true,
+			LongLivedEnabled:    longLivedRestartTime > 0,
+		}
+	}
+
+	// IPv6 prefixes are announced via MP-BGP regardless of the session's
+	// transport, so both unicast families are negotiated by default.
+	for _, family := range neighbor.GetFamilies() {
+		afiSafi := config.AfiSafi{
+			Config: config.AfiSafiConfig{AfiSafiName: config.AfiSafiType(family), Enabled: true},
+		}
+		afiSafi.MpGracefulRestart.Config.Enabled = gracefulRestart
+		if gracefulRestart && longLivedRestartTime > 0 {
+			afiSafi.LongLivedGracefulRestart.Config = config.LongLivedGracefulRestartConfig{
+				Enabled:     true,
+				RestartTime: uint32(longLivedRestartTime.Seconds()),
+			}
+		}
+		n.AfiSafis = append(n.AfiSafis, afiSafi)
+	}
+
+	return n
+}
@@ -0,0 +1,187 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/osrg/gobgp/packet/bgp"
+	"github.com/sapcc/kube-parrot/pkg/util"
+)
+
+// MemorySpeaker keeps announcements in memory instead of sending them to
+// neighbors. It can record every call, so the decisions of the controllers
+// can be checked without a BGP session.
+type MemorySpeaker struct {
+	mu          sync.Mutex
+	neighbors   map[string]util.Neighbor
+	routes      map[string]Route
+	recordCalls bool
+	calls       []SpeakerCall
+}
+
+// SpeakerCall is an announcement or withdrawal recorded by a MemorySpeaker.
+type SpeakerCall struct {
+	Withdraw bool
+	Route    Route
+}
+
+func (c SpeakerCall) String() string {
+	if c.Withdraw {
+		return "withdraw " + describeAnnouncement(c.Route)
+	}
+	return "announce " + describeAnnouncement(c.Route)
+}
+
+// NewMemorySpeaker creates a speaker that only keeps the current routes,
+// unless recordCalls is set. The recorded calls grow without bound, so
+// long-running speakers, like the one of a dry run, shouldn't record them.
+func NewMemorySpeaker(recordCalls bool) *MemorySpeaker {
+	return &MemorySpeaker{
+		neighbors:   map[string]util.Neighbor{},
+		routes:      map[string]Route{},
+		recordCalls: recordCalls,
+	}
+}
+
+func (s *MemorySpeaker) Start(global GlobalConfig) error {
+	return nil
+}
+
+func (s *MemorySpeaker) Stop() {}
+
+func (s *MemorySpeaker) AddNeighbor(neighbor util.Neighbor, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.neighbors[neighbor.Address]; ok {
+		return fmt.Errorf("Oops. Something went wrong adding neighbor: %s already exists", neighbor.Address)
+	}
+	s.neighbors[neighbor.Address] = neighbor
+	return nil
+}
+
+func (s *MemorySpeaker) UpdateNeighbor(neighbor util.Neighbor, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.neighbors[neighbor.Address] = neighbor
+	return nil
+}
+
+func (s *MemorySpeaker) RemoveNeighbor(address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.neighbors, address)
+	return nil
+}
+
+func (s *MemorySpeaker) ResetNeighbor(address, reason string) error {
+	return nil
+}
+
+func (s *MemorySpeaker) ShutdownNeighbor(address, reason string) error {
+	return nil
+}
+
+func (s *MemorySpeaker) Announce(route Route) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.routes[routePrefix(route)] = route
+	if s.recordCalls {
+		s.calls = append(s.calls, SpeakerCall{Route: route})
+	}
+	return nil
+}
+
+func (s *MemorySpeaker) Withdraw(route Route) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.routes, routePrefix(route))
+	if s.recordCalls {
+		s.calls = append(s.calls, SpeakerCall{Withdraw: true, Route: route})
+	}
+	return nil
+}
+
+// Peers reports all neighbors as established, as if they had received the
+// announced routes.
+func (s *MemorySpeaker) Peers() ([]Peer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var peers []Peer
+	for address := range s.neighbors {
+		peer := Peer{Address: address, State: "established", AdvertisedPrefixes: map[bgp.RouteFamily]int{}}
+		for _, route := range s.routes {
+			peer.Advertised++
+			peer.AdvertisedPrefixes[route.Family()]++
+		}
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Address < peers[j].Address })
+	return peers, nil
+}
+
+// WatchPeers never calls f, as sessions don't change state.
+func (s *MemorySpeaker) WatchPeers(f func(Peer)) {}
+
+// Routes returns the currently announced routes, ordered by prefix.
+func (s *MemorySpeaker) Routes() []Route {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefixes := make([]string, 0, len(s.routes))
+	for prefix := range s.routes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	routes := make([]Route, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		routes = append(routes, s.routes[prefix])
+	}
+	return routes
+}
+
+// Announced describes the currently announced routes as "prefix -> next
+// hop", ordered by prefix, which is convenient to compare.
+func (s *MemorySpeaker) Announced() []string {
+	var announced []string
+	for _, route := range s.Routes() {
+		announced = append(announced, describeAnnouncement(route))
+	}
+	return announced
+}
+
+// Calls returns all announcements and withdrawals in the order they were
+// made, if the speaker records them.
+func (s *MemorySpeaker) Calls() []SpeakerCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]SpeakerCall(nil), s.calls...)
+}
+
+// ResetCalls forgets the recorded calls, but not the announced routes.
+func (s *MemorySpeaker) ResetCalls() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = nil
+}
+
+func routePrefix(route Route) string {
+	prefix, length := route.Source()
+	return fmt.Sprintf("%s/%d", prefix, length)
+}
+
+func describeAnnouncement(route Route) string {
+	return fmt.Sprintf("%s -> %s", routePrefix(route), route.NextHop())
+}
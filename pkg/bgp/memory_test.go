@@ -0,0 +1,39 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMemorySpeakerRecordsCallsOnlyIfAsked(t *testing.T) {
+	hostIP := net.ParseIP("10.0.0.1")
+	svc := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "a"}}
+	route := Route{RouteInterface: NewExternalIPRoute(svc, "1.2.3.4", &hostIP, false)}
+
+	for _, record := range []bool{false, true} {
+		s := NewMemorySpeaker(record)
+		for i := 0; i < 3; i++ {
+			s.Announce(route)
+			s.Withdraw(route)
+		}
+		s.Announce(route)
+
+		if got := s.Announced(); !reflect.DeepEqual(got, []string{"1.2.3.4/32 -> 10.0.0.1"}) {
+			t.Errorf("recording %t: announced %v", record, got)
+		}
+		want := 0
+		if record {
+			want = 7
+		}
+		if n := len(s.Calls()); n != want {
+			t.Errorf("recording %t: %d calls recorded, expected %d", record, n, want)
+		}
+	}
+}
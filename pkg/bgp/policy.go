@@ -0,0 +1,126 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/sapcc/kube-parrot/pkg/util"
+)
+
+// PrefixPolicy restricts the prefixes that routes to services are announced
+// for, so services can't hijack addresses they don't own. A nil policy or
+// one without rules allows all prefixes.
+type PrefixPolicy struct {
+	rules []prefixRule
+}
+
+type prefixRule struct {
+	prefixes   []*net.IPNet
+	namespaces map[string]bool
+}
+
+// RefusedError is returned for routes whose prefix isn't allowed.
+type RefusedError struct {
+	Route RouteInterface
+}
+
+func (e *RefusedError) Error() string {
+	prefix, length := e.Route.Source()
+	namespace, _ := routeNamespace(e.Route)
+	return fmt.Sprintf("prefix %s/%d isn't allowed for namespace %s", prefix, length, namespace)
+}
+
+// NewPrefixPolicy builds a policy from the configured allowed prefixes.
+func NewPrefixPolicy(allowed []util.AllowedPrefixes) (*PrefixPolicy, error) {
+	p := &PrefixPolicy{}
+	for _, a := range allowed {
+		rule := prefixRule{}
+		for _, prefix := range a.Prefixes {
+			_, ipnet, err := net.ParseCIDR(prefix)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed prefix %q: %s", prefix, err)
+			}
+			rule.prefixes = append(rule.prefixes, ipnet)
+		}
+		if len(a.Namespaces) > 0 {
+			rule.namespaces = map[string]bool{}
+			for _, namespace := range a.Namespaces {
+				rule.namespaces[namespace] = true
+			}
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+// Allows checks whether the route may be announced. Only routes to services
+// are restricted.
+func (p *PrefixPolicy) Allows(route RouteInterface) bool {
+	if p == nil || len(p.rules) == 0 {
+		return true
+	}
+
+	namespace, ok := routeNamespace(route)
+	if !ok {
+		return true
+	}
+
+	prefix, length := route.Source()
+	if prefix == nil {
+		return false
+	}
+
+	for _, rule := range p.rules {
+		if rule.namespaces != nil && !rule.namespaces[namespace] {
+			continue
+		}
+		for _, ipnet := range rule.prefixes {
+			ones, bits := ipnet.Mask.Size()
+			if ipnet.Contains(*prefix) && int(length) >= ones && hostPrefixLength(*prefix) == uint8(bits) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetPrefixPolicy restricts the prefixes of routes to services. It must be
+// set before routes are added.
+func (s *Server) SetPrefixPolicy(policy *PrefixPolicy) {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	s.policy = policy
+}
+
+// RefusedRoutes returns the number of routes currently refused by the
+// prefix policy.
+func (s *Server) RefusedRoutes() (refused int) {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	for _, store := range s.stores() {
+		refused += len(store.refused)
+	}
+	return refused
+}
+
+// Refusals returns the number of times routes were refused by the prefix
+// policy.
+func (s *Server) Refusals() uint64 {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	return s.refusals
+}
+
+// routeNamespace returns the namespace of the service a route belongs to.
+func routeNamespace(route RouteInterface) (string, bool) {
+	if svc := RouteService(route); svc != nil {
+		return svc.Namespace, true
+	}
+	return "", false
+}
@@ -19,40 +19,88 @@ type RouteInterface interface {
 	Source() (*net.IP, uint8)
 	NextHop() *net.IP
 	Describe() string
+	Attributes() PathAttributes
 	Path(bool) *table.Path
 }
 
 type Route struct {
 	RouteInterface
+	// LocalAS is the AS the route is originated from. It is required to
+	// build paths with a prepended AS path.
+	LocalAS uint32
+	// Depreference is applied on top of the route's own attributes.
+	Depreference Depreference
 }
 
 func (r Route) String() string {
 	prefix, length := r.Source()
 
-	return fmt.Sprintf("%16s/%v -> %-15s (%s)", prefix.To4().String(), length, r.NextHop().To4().String(), r.Describe())
+	return fmt.Sprintf("%16s/%v -> %-15s (%s)", prefix.String(), length, r.NextHop().String(), r.Describe())
+}
+
+// Family returns the BGP address family of the route's prefix.
+func (r Route) Family() bgp.RouteFamily {
+	prefix, _ := r.Source()
+	return RouteFamily(*prefix)
+}
+
+// EffectiveAttributes returns the attributes of the route with the
+// depreference applied.
+func (r Route) EffectiveAttributes() PathAttributes {
+	return r.RouteInterface.Attributes().depreferred(r.Depreference)
 }
 
 func (r Route) Path(isWithdraw bool) *table.Path {
 	prefix, length := r.Source()
-	nlri := bgp.NewIPAddrPrefix(length, prefix.To4().String())
 
 	pattr := []bgp.PathAttributeInterface{
 		bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP),
-		bgp.NewPathAttributeNextHop(r.NextHop().To4().String()),
 	}
 
+	var nlri bgp.AddrPrefixInterface
+	if r.Family() == bgp.RF_IPv4_UC {
+		nlri = bgp.NewIPAddrPrefix(length, prefix.To4().String())
+		pattr = append(pattr, bgp.NewPathAttributeNextHop(r.NextHop().To4().String()))
+	} else {
+		// IPv6 reachability is only carried in MP_REACH_NLRI (RFC 4760)
+		nlri = bgp.NewIPv6AddrPrefix(length, prefix.To16().String())
+		pattr = append(pattr, bgp.NewPathAttributeMpReachNLRI(r.NextHop().To16().String(), []bgp.AddrPrefixInterface{nlri}))
+	}
+
+	pattr = append(pattr, r.EffectiveAttributes().pathAttributes(r.LocalAS)...)
+
 	return table.NewPath(nil, nlri, isWithdraw, pattr, time.Now(), false)
 }
 
+// RouteFamily returns the unicast address family an IP belongs to.
+func RouteFamily(ip net.IP) bgp.RouteFamily {
+	if ip.To4() != nil {
+		return bgp.RF_IPv4_UC
+	}
+	return bgp.RF_IPv6_UC
+}
+
+// hostPrefixLength returns the prefix length of a single host route for the given IP.
+func hostPrefixLength(ip net.IP) uint8 {
+	if ip.To4() != nil {
+		return 32
+	}
+	return 128
+}
+
 type ExternalIPRoute struct {
 	Route
-	Service *v1.Service
-	HostIP  *net.IP
+	Service    *v1.Service
+	ExternalIP string
+	HostIP     *net.IP
+	// Terminating is set while the only endpoints of the service are
+	// terminating, but still serving.
+	Terminating bool
 }
 
 func (r ExternalIPRoute) Source() (*net.IP, uint8) {
-	ip := net.ParseIP(r.Service.Spec.ExternalIPs[0])
-	return &ip, uint8(32)
+	ip := net.ParseIP(r.ExternalIP)
+	return &ip, hostPrefixLength(ip)
 }
 
 func (r ExternalIPRoute) NextHop() *net.IP {
@@ -60,28 +108,86 @@ func (r ExternalIPRoute) NextHop() *net.IP {
 }
 
 func (r ExternalIPRoute) Describe() string {
-	return fmt.Sprintf("ExternalIP:    %s/%s -> %s", r.Service.Namespace, r.Service.Name, r.HostIP)
+	return fmt.Sprintf("ExternalIP:    %s/%s -> %s%s", r.Service.Namespace, r.Service.Name, r.HostIP, describeTerminating(r.Terminating))
+}
+
+// Attributes ignores invalid annotations. They are reported by the controller.
+func (r ExternalIPRoute) Attributes() PathAttributes {
+	return serviceRouteAttributes(r.Service, r.Terminating)
 }
 
-func NewExternalIPRoute(service *v1.Service, hostIP *net.IP) RouteInterface {
-	return ExternalIPRoute{Route{}, service, hostIP}
+func NewExternalIPRoute(service *v1.Service, externalIP string, hostIP *net.IP, terminating bool) RouteInterface {
+	return ExternalIPRoute{Route{}, service, externalIP, hostIP, terminating}
+}
+
+type LoadBalancerIPRoute struct {
+	Route
+	Service   *v1.Service
+	IngressIP string
+	HostIP    *net.IP
+	// Terminating is set while the only endpoints of the service are
+	// terminating, but still serving.
+	Terminating bool
+}
+
+func (r LoadBalancerIPRoute) Source() (*net.IP, uint8) {
+	ip := net.ParseIP(r.IngressIP)
+	return &ip, hostPrefixLength(ip)
+}
+
+func (r LoadBalancerIPRoute) NextHop() *net.IP {
+	return r.HostIP
+}
+
+func (r LoadBalancerIPRoute) Describe() string {
+	return fmt.Sprintf("LoadBalancer:  %s/%s -> %s%s", r.Service.Namespace, r.Service.Name, r.HostIP, describeTerminating(r.Terminating))
+}
+
+// Attributes ignores invalid annotations. They are reported by the controller.
+func (r LoadBalancerIPRoute) Attributes() PathAttributes {
+	return serviceRouteAttributes(r.Service, r.Terminating)
+}
+
+func NewLoadBalancerIPRoute(service *v1.Service, ingressIP string, hostIP *net.IP, terminating bool) RouteInterface {
+	return LoadBalancerIPRoute{Route{}, service, ingressIP, hostIP, terminating}
+}
+
+// serviceRouteAttributes returns the attributes of a route to a service,
+// depreferred as requested while its endpoints are terminating.
+func serviceRouteAttributes(svc *v1.Service, terminating bool) PathAttributes {
+	attrs, _ := ServiceAttributes(svc)
+	if terminating {
+		_, depreference, _ := TerminatingEndpoints(svc)
+		attrs = attrs.depreferred(depreference)
+	}
+	return attrs
+}
+
+func describeTerminating(terminating bool) string {
+	if terminating {
+		return " (terminating)"
+	}
+	return ""
 }
 
 type NodePodSubnetRoute struct {
 	Route
-	Node *v1.Node
+	Node   *v1.Node
+	Subnet string
 }
 
-func NewNodePodSubnetRoute(node *v1.Node) RouteInterface {
-	return NodePodSubnetRoute{Route{}, node}
+func NewNodePodSubnetRoute(node *v1.Node, subnet string) RouteInterface {
+	return NodePodSubnetRoute{Route{}, node, subnet}
+}
+
+// Attributes ignores invalid annotations. They are reported by the controller.
+func (r NodePodSubnetRoute) Attributes() PathAttributes {
+	attrs, _ := NodeAttributes(r.Node)
+	return attrs
 }
 
 func (r NodePodSubnetRoute) Source() (*net.IP, uint8) {
-	subnet, err := util.GetNodePodSubnet(r.Node)
-	if err != nil {
-		return nil, 0
-	}
-	ip, ipnet, err := net.ParseCIDR(subnet)
+	ip, ipnet, err := net.ParseCIDR(r.Subnet)
 	if err != nil {
 		return nil, 0
 	}
@@ -90,7 +196,12 @@ func (r NodePodSubnetRoute) Source() (*net.IP, uint8) {
 }
 
 func (r NodePodSubnetRoute) NextHop() *net.IP {
-	nexthop, err := util.GetNodeInternalIP(r.Node)
+	prefix, _ := r.Source()
+	if prefix == nil {
+		return nil
+	}
+
+	nexthop, err := util.GetNodeInternalIPOfFamily(r.Node, prefix.To4() == nil)
 	if err != nil {
 		return nil
 	}
@@ -100,5 +211,5 @@ func (r NodePodSubnetRoute) NextHop() *net.IP {
 
 func (r NodePodSubnetRoute) Describe() string {
 	prefix, length := r.Source()
-	return fmt.Sprintf("NodePodSubnet: %s/%v -> %s", prefix.To4().String(), length, r.Node.Name)
+	return fmt.Sprintf("NodePodSubnet: %s/%v -> %s", prefix.String(), length, r.Node.Name)
 }
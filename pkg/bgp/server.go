@@ -4,48 +4,64 @@
 package bgp
 
 import (
-	"context"
-	"errors"
-	"fmt"
 	"net"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
-	api "github.com/osrg/gobgp/api"
-	"github.com/osrg/gobgp/config"
-	gobgp "github.com/osrg/gobgp/server"
+	"github.com/sapcc/kube-parrot/pkg/util"
 )
 
 type Server struct {
-	bgp  *gobgp.BgpServer
-	grpc *api.Server
+	speaker Speaker
 
 	as           uint32
 	remoteAs     uint32
 	routerId     string
 	localAddress string
 
-	ExternalIPRoutes    *ExternalIPRoutesStore
-	NodePodSubnetRoutes *NodePodSubnetRoutesStore
+	restartTime          time.Duration
+	longLivedRestartTime time.Duration
+
+	mu        sync.Mutex
+	neighbors map[string]util.Neighbor
+	passwords map[string]string
+
+	// routesMu serializes changes to the routes stores with changes to how
+	// all routes are announced.
+	routesMu     sync.Mutex
+	depreference Depreference
+	withdrawn    bool
+	stopping     bool
+	shutdown     ShutdownOptions
+
+	holdDown             HoldDown
+	cancelledTransitions uint64
+
+	policy   *PrefixPolicy
+	refusals uint64
+
+	ExternalIPRoutes     *ExternalIPRoutesStore
+	LoadBalancerIPRoutes *LoadBalancerIPRoutesStore
+	NodePodSubnetRoutes  *NodePodSubnetRoutesStore
 }
 
-func NewServer(localAddress *net.IP, as int, remoteAs int, port int) *Server {
+func NewServer(speaker Speaker, localAddress *net.IP, as int, remoteAs int) *Server {
 	server := &Server{
+		speaker:      speaker,
 		localAddress: localAddress.String(),
 		routerId:     localAddress.String(),
 		as:           uint32(as),
 		remoteAs:     uint32(remoteAs),
+		neighbors:    map[string]util.Neighbor{},
+		passwords:    map[string]string{},
 	}
 
-	server.ExternalIPRoutes = newExternalIPRoutesStore(server)
-	server.NodePodSubnetRoutes = newNodePodSubnetRoutesStore(server)
-
-	server.bgp = gobgp.NewBgpServer()
-	server.grpc = api.NewGrpcServer(
-		server.bgp,
-		fmt.Sprintf(":%v", port),
-	)
+	// External and ingress IPs of services compete for the same prefixes.
+	serviceClaims := newClaimRegistry()
+	server.ExternalIPRoutes = newExternalIPRoutesStore(server, serviceClaims)
+	server.LoadBalancerIPRoutes = newLoadBalancerIPRoutesStore(server, serviceClaims)
+	server.NodePodSubnetRoutes = newNodePodSubnetRoutesStore(server, newClaimRegistry())
 
 	return server
 }
@@ -54,63 +70,201 @@ func (s *Server) Run(stopCh <-chan struct{}, wg *sync.WaitGroup) {
 	defer wg.Done()
 	wg.Add(1)
 
-	// logrus.SetLevel(logrus.DebugLevel)
-
-	go s.bgp.Serve()
-	go s.grpc.Serve()
-
-	time.Sleep(1 * time.Second)
-	s.startServer()
+	err := s.speaker.Start(GlobalConfig{
+		AS:                           s.as,
+		RouterID:                     s.routerId,
+		RemoteAS:                     s.remoteAs,
+		GracefulRestartTime:          s.restartTime,
+		LongLivedGracefulRestartTime: s.longLivedRestartTime,
+	})
+	if err != nil {
+		glog.Errorf("Oops. Something went wrong starting bgp speaker: %s", err)
+	}
+	s.speaker.WatchPeers(func(peer Peer) {
+		glog.Infof("Neighbor %s is %s", peer.Address, peer.State)
+	})
 
 	<-stopCh
-	s.bgp.Stop()
+	s.gracefulShutdown()
+	s.speaker.Stop()
 	time.Sleep(1 * time.Second)
 }
 
-func (s *Server) startServer() {
-	global := &config.Global{
-		Config: config.GlobalConfig{
-			As:       s.as,
-			RouterId: s.routerId,
-			Port:     -1,
-		},
+// EnableGracefulRestart negotiates graceful restart (RFC 4724) with all
+// neighbors, so they keep forwarding to this node while parrot restarts.
+// Long-lived graceful restart (RFC 9494) is negotiated, too, if
+// longLivedRestartTime isn't zero. It must be called before Run.
+func (s *Server) EnableGracefulRestart(restartTime, longLivedRestartTime time.Duration) {
+	s.restartTime = restartTime
+	s.longLivedRestartTime = longLivedRestartTime
+}
+
+func (s *Server) AddNeighbor(neighbor util.Neighbor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	peerAs := neighbor.RemoteAS
+	if peerAs == 0 {
+		peerAs = s.remoteAs
+	}
+	glog.Infof("Adding Neighbor: %s remote ASN %d", neighbor.Address, peerAs)
+	if err := s.speaker.AddNeighbor(neighbor, s.passwords[neighbor.Address]); err != nil {
+		glog.Error(err)
+		return
+	}
+	s.neighbors[neighbor.Address] = neighbor
+}
+
+// SetNeighborPassword sets the TCP MD5 password used for the session with a
+// neighbor. Changing the password of a neighbor that was already added
+// resets its session. Passwords set before AddNeighbor are used from the
+// start.
+func (s *Server) SetNeighborPassword(address, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.passwords[address]; ok && old == password {
+		return nil
 	}
+	s.passwords[address] = password
 
-	if err := s.bgp.Start(global); err != nil {
-		glog.Errorf("Oops. Something went wrong starting bgp server: %s", err)
+	neighbor, ok := s.neighbors[address]
+	if !ok {
+		return nil
 	}
+
+	glog.Infof("Password of Neighbor %s changed. Resetting session", address)
+	return s.speaker.UpdateNeighbor(neighbor, password)
 }
 
-func (s *Server) AddNeighbor(neighbor string) {
-	glog.Infof("Adding Neighbor: %s remote ASN %d", neighbor, s.remoteAs)
-	n := &config.Neighbor{
-		Config: config.NeighborConfig{
-			NeighborAddress: neighbor,
-			PeerAs:          s.remoteAs,
-		},
+// Deprefer announces the routes of services again with the given
+// depreference. Routes added later are depreferred as well. Pod subnet
+// routes aren't depreferred, as draining a node doesn't evict its pods.
+func (s *Server) Deprefer(d Depreference) error {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	if s.stopping {
+		return nil
 	}
+	return s.deprefer(d, s.serviceStores())
+}
 
-	if err := s.bgp.AddNeighbor(n); err != nil {
-		glog.Errorf("Oops. Something went wrong adding neighbor: %s", err)
+func (s *Server) deprefer(d Depreference, stores []*RoutesStore) error {
+	s.depreference = d
+
+	for _, store := range stores {
+		if err := store.deprefer(d); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (s *Server) GetNeighbor(address string) ([]*api.Peer, error) {
-	resp, err := s.grpc.GetNeighbor(context.Background(), &api.GetNeighborRequest{
-		Address:          address,
-		EnableAdvertised: true,
-	})
-	if err != nil {
-		return nil, err
+// SetWithdrawn withdraws the routes of services or announces them again.
+// While they are withdrawn, the stores keep track of added and deleted
+// routes without announcing them. Pod subnet routes stay announced, as
+// draining a node doesn't evict its pods. They are only withdrawn on
+// shutdown.
+func (s *Server) SetWithdrawn(withdrawn bool) error {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	if s.stopping {
+		return nil
 	}
+	return s.setWithdrawn(withdrawn, s.serviceStores())
+}
 
-	// GoBGP server didn't return any neighbors (aka peers) though there are some configured.
-	if resp.GetPeers() == nil {
-		return nil, errors.New("invalid reply from goBGP server")
+func (s *Server) setWithdrawn(withdrawn bool, stores []*RoutesStore) error {
+	s.withdrawn = withdrawn
+
+	for _, store := range stores {
+		if err := store.setWithdrawn(withdrawn); err != nil {
+			return err
+		}
 	}
-	if len(resp.GetPeers()) == 0 {
-		return nil, errors.New("invalid reply from goBGP server")
+	return nil
+}
+
+// HoldDown delays announcements and withdrawals of routes, so flapping
+// endpoints don't cause churn. A route is only announced once it was wanted
+// for AnnounceDelay and only withdrawn once it was unwanted for
+// WithdrawDelay. Only routes that lost their endpoints or health are held
+// down before being withdrawn. Routes that were removed explicitly, e.g.
+// with their service, are withdrawn right away.
+type HoldDown struct {
+	AnnounceDelay time.Duration
+	WithdrawDelay time.Duration
+}
+
+// SetHoldDown configures the hold-down of route transitions. It applies to
+// transitions starting afterwards.
+func (s *Server) SetHoldDown(holdDown HoldDown) {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	s.holdDown = holdDown
+}
+
+// PendingTransitions returns the number of held down announcements and
+// withdrawals.
+func (s *Server) PendingTransitions() (announcements, withdrawals int) {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	for _, store := range s.stores() {
+		a, w := store.pendingTransitions()
+		announcements, withdrawals = announcements+a, withdrawals+w
 	}
+	return announcements, withdrawals
+}
+
+// CancelledTransitions returns the number of announcements and withdrawals
+// that were reverted before their hold-down passed.
+func (s *Server) CancelledTransitions() uint64 {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	return s.cancelledTransitions
+}
+
+// AnnouncementState returns whether the routes of services are currently
+// withdrawn or depreferred.
+func (s *Server) AnnouncementState() (withdrawn, depreferred bool) {
+	s.routesMu.Lock()
+	defer s.routesMu.Unlock()
+
+	return s.withdrawn, s.depreference.Mode != ""
+}
+
+func (s *Server) stores() []*RoutesStore {
+	return append(s.serviceStores(), &s.NodePodSubnetRoutes.store)
+}
+
+// serviceStores returns the stores of the routes that are moved away from
+// a draining node.
+func (s *Server) serviceStores() []*RoutesStore {
+	return []*RoutesStore{&s.ExternalIPRoutes.store, &s.LoadBalancerIPRoutes.store}
+}
+
+// ResetNeighbor tears down the session with a neighbor. It is
+// re-established once the neighbor is reachable again.
+func (s *Server) ResetNeighbor(neighbor, reason string) error {
+	glog.Infof("Resetting Neighbor: %s (%s)", neighbor, reason)
+	return s.speaker.ResetNeighbor(neighbor, reason)
+}
+
+// SpeakerHealthy returns why the speaker couldn't apply the announced
+// routes, or nil if it did.
+func (s *Server) SpeakerHealthy() error {
+	if h, ok := s.speaker.(healthReporter); ok {
+		return h.Healthy()
+	}
+	return nil
+}
 
-	return resp.GetPeers(), nil
+// Peers returns the state of the sessions with all neighbors.
+func (s *Server) Peers() ([]Peer, error) {
+	return s.speaker.Peers()
 }
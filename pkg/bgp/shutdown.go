@@ -0,0 +1,107 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// shutdownReserve is kept from the drain period for withdrawing the
+	// routes and notifying the neighbors before the shutdown timeout.
+	shutdownReserve = 3 * time.Second
+	// shutdownFlush gives GoBGP time to send the withdraws before the
+	// sessions are closed.
+	shutdownFlush = 1 * time.Second
+)
+
+// ShutdownOptions configure the phases of an orderly shutdown: routes are
+// depreferred, then parrot waits for traffic to drain, withdraws all routes
+// and closes the sessions with a CEASE notification. All of it is bounded by
+// Timeout, which should be lower than the pod's termination grace period.
+type ShutdownOptions struct {
+	Depreference Depreference
+	DrainTime    time.Duration
+	Withdraw     bool
+	Timeout      time.Duration
+}
+
+// SetShutdownOptions configures what happens once the server is stopped.
+func (s *Server) SetShutdownOptions(opts ShutdownOptions) {
+	s.shutdown = opts
+}
+
+// gracefulShutdown runs the configured shutdown phases, giving up once the
+// shutdown timeout expired.
+func (s *Server) gracefulShutdown() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.runShutdownPhases()
+	}()
+
+	if s.shutdown.Timeout == 0 {
+		<-done
+		return
+	}
+
+	select {
+	case <-done:
+	case <-time.After(s.shutdown.Timeout):
+		glog.Errorf("Orderly shutdown didn't finish within %s", s.shutdown.Timeout)
+	}
+}
+
+func (s *Server) runShutdownPhases() {
+	deadline := time.Now().Add(s.shutdown.Timeout)
+
+	// From now on, the shutdown phases decide how routes are announced.
+	s.routesMu.Lock()
+	s.stopping = true
+	s.routesMu.Unlock()
+
+	if s.shutdown.Depreference.Mode != "" {
+		glog.Infof("Shutting down. Depreferring all routes (%s)", s.shutdown.Depreference.Mode)
+		s.routesMu.Lock()
+		err := s.deprefer(s.shutdown.Depreference, s.stores())
+		s.routesMu.Unlock()
+		if err != nil {
+			glog.Errorf("Couldn't deprefer routes: %s", err)
+		}
+	}
+
+	if drain := s.shutdown.DrainTime; drain > 0 {
+		if s.shutdown.Timeout > 0 {
+			if remaining := time.Until(deadline) - shutdownReserve; remaining < drain {
+				drain = remaining
+			}
+		}
+		if drain > 0 {
+			glog.Infof("Shutting down. Waiting %s for traffic to drain", drain)
+			time.Sleep(drain)
+		}
+	}
+
+	if s.shutdown.Withdraw {
+		glog.Infof("Shutting down. Withdrawing all routes")
+		s.routesMu.Lock()
+		err := s.setWithdrawn(true, s.stores())
+		s.routesMu.Unlock()
+		if err != nil {
+			glog.Errorf("Couldn't withdraw routes: %s", err)
+		}
+		time.Sleep(shutdownFlush)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for address := range s.neighbors {
+		glog.Infof("Shutting down Neighbor: %s", address)
+		if err := s.speaker.ShutdownNeighbor(address, "kube-parrot shutting down"); err != nil {
+			glog.Errorf("Couldn't shut down neighbor %s: %s", address, err)
+		}
+	}
+}
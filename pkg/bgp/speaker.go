@@ -0,0 +1,83 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package bgp
+
+import (
+	"time"
+
+	"github.com/osrg/gobgp/packet/bgp"
+	"github.com/sapcc/kube-parrot/pkg/util"
+)
+
+// Speaker talks BGP to the neighbors on behalf of the server. The server
+// decides which routes are announced, the speaker announces them.
+type Speaker interface {
+	// Start starts the speaker. Neighbors and routes are added afterwards.
+	Start(global GlobalConfig) error
+	// Stop closes all sessions and stops the speaker.
+	Stop()
+
+	AddNeighbor(neighbor util.Neighbor, password string) error
+	// UpdateNeighbor applies a changed configuration of a neighbor. It may
+	// reset the session.
+	UpdateNeighbor(neighbor util.Neighbor, password string) error
+	RemoveNeighbor(address string) error
+	// ResetNeighbor tears down the session, which is re-established once
+	// the neighbor is reachable again.
+	ResetNeighbor(address, reason string) error
+	// ShutdownNeighbor closes the session with a CEASE notification and
+	// doesn't re-establish it.
+	ShutdownNeighbor(address, reason string) error
+
+	// Announce announces a route or replaces the announcement of its prefix.
+	Announce(route Route) error
+	Withdraw(route Route) error
+
+	// Peers returns the state of the sessions with all neighbors.
+	Peers() ([]Peer, error)
+	// WatchPeers calls f whenever the session state of a neighbor changes.
+	WatchPeers(f func(Peer))
+}
+
+// healthReporter is implemented by speakers that apply announcements in the
+// background, so applying them might fail after Announce or Withdraw
+// returned.
+type healthReporter interface {
+	Healthy() error
+}
+
+// GlobalConfig are the settings of the speaker that apply to all neighbors.
+type GlobalConfig struct {
+	AS       uint32
+	RouterID string
+	// RemoteAS is used for neighbors without a remote AS of their own.
+	RemoteAS uint32
+
+	// GracefulRestartTime enables graceful restart (RFC 4724) if it isn't
+	// zero. LongLivedGracefulRestartTime enables long-lived graceful restart
+	// (RFC 9494) on top.
+	GracefulRestartTime          time.Duration
+	LongLivedGracefulRestartTime time.Duration
+}
+
+// peerAS returns the remote AS of a neighbor.
+func (g GlobalConfig) peerAS(neighbor util.Neighbor) uint32 {
+	if neighbor.RemoteAS != 0 {
+		return neighbor.RemoteAS
+	}
+	return g.RemoteAS
+}
+
+// Peer is the state of the session with a neighbor.
+type Peer struct {
+	Address string
+	// State is one of idle, connect, active, opensent, openconfirm or
+	// established.
+	State string
+	// Advertised is the number of routes advertised to the neighbor.
+	Advertised uint64
+	// AdvertisedPrefixes counts the advertised prefixes per address family.
+	// Speakers that can't tell leave it empty.
+	AdvertisedPrefixes map[bgp.RouteFamily]int
+}
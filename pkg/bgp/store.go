@@ -4,14 +4,14 @@
 package bgp
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 
 	"strconv"
+	"time"
 
 	"github.com/golang/glog"
-	"github.com/osrg/gobgp/packet/bgp"
-	"github.com/osrg/gobgp/table"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/cache"
 )
@@ -19,12 +19,46 @@ import (
 type RoutesStore struct {
 	cache.Store
 	server *Server
+
+	// pending holds announcements and withdrawals waiting for their hold
+	// down to pass.
+	pending map[string]*transition
+	// refused holds the routes refused by the prefix policy.
+	refused map[string]RouteInterface
+	// claims holds the routes of all owners of a prefix. It might be
+	// shared with other stores announcing the same prefixes.
+	claims *claimRegistry
+
+	// withdrawn and depreference control how all routes of the store are
+	// announced, e.g. while the node is drained.
+	withdrawn    bool
+	depreference Depreference
+}
+
+// transition is an announcement or withdrawal of a route that is delayed
+// until it wasn't reverted for the hold-down time.
+type transition struct {
+	withdraw bool
+	route    RouteInterface
+	since    time.Time
+	timer    *time.Timer
+}
+
+func (t *transition) String() string {
+	if t.withdraw {
+		return "withdrawal"
+	}
+	return "announcement"
 }
 
 type ExternalIPRoutesStore struct {
 	store RoutesStore
 }
 
+type LoadBalancerIPRoutesStore struct {
+	store RoutesStore
+}
+
 type NodePodSubnetRoutesStore struct {
 	store RoutesStore
 }
@@ -32,42 +66,416 @@ type NodePodSubnetRoutesStore struct {
 func RouteKeyFunc(obj interface{}) (string, error) {
 	route := obj.(RouteInterface)
 	prefix, length := route.Source()
-	return fmt.Sprintf("%s/%s->%s", prefix, strconv.Itoa(int(length)), route.NextHop().To4().String()), nil
+	return fmt.Sprintf("%s/%s->%s", prefix, strconv.Itoa(int(length)), route.NextHop().String()), nil
 }
 
-func newExternalIPRoutesStore(bgp *Server) *ExternalIPRoutesStore {
-	return &ExternalIPRoutesStore{RoutesStore{cache.NewStore(RouteKeyFunc), bgp}}
+func newRoutesStore(bgp *Server, claims *claimRegistry) RoutesStore {
+	return RoutesStore{Store: cache.NewStore(RouteKeyFunc), server: bgp, pending: map[string]*transition{}, refused: map[string]RouteInterface{},
+		claims: claims}
 }
 
-func newNodePodSubnetRoutesStore(bgp *Server) *NodePodSubnetRoutesStore {
-	return &NodePodSubnetRoutesStore{RoutesStore{cache.NewStore(RouteKeyFunc), bgp}}
+func newExternalIPRoutesStore(bgp *Server, claims *claimRegistry) *ExternalIPRoutesStore {
+	s := &ExternalIPRoutesStore{newRoutesStore(bgp, claims)}
+	claims.stores = append(claims.stores, &s.store)
+	return s
+}
+
+func newLoadBalancerIPRoutesStore(bgp *Server, claims *claimRegistry) *LoadBalancerIPRoutesStore {
+	s := &LoadBalancerIPRoutesStore{newRoutesStore(bgp, claims)}
+	claims.stores = append(claims.stores, &s.store)
+	return s
+}
+
+func newNodePodSubnetRoutesStore(bgp *Server, claims *claimRegistry) *NodePodSubnetRoutesStore {
+	s := &NodePodSubnetRoutesStore{newRoutesStore(bgp, claims)}
+	claims.stores = append(claims.stores, &s.store)
+	return s
 }
 
 func (s *RoutesStore) Add(route RouteInterface) error {
-	if _, exists, _ := s.Store.Get(route); !exists {
-		glog.Infof("Announcing  %s\n", Route{route})
+	s.server.routesMu.Lock()
+	defer s.server.routesMu.Unlock()
+
+	if prefix, _ := route.Source(); prefix == nil || len(*prefix) == 0 {
+		return fmt.Errorf("Oops. Something went wrong. Invalid prefix of route for %s", routeOwner(route))
+	}
+
+	key, _ := RouteKeyFunc(route)
+	owner := routeOwner(route)
+	if !s.server.policy.Allows(route) {
+		return s.refuse(key+" "+owner, route)
+	}
 
-		if _, err := s.server.bgp.AddPath("", []*table.Path{Route{route}.Path(false)}); err != nil {
-			return fmt.Errorf("Oops. Something went wrong adding path: %s", err)
+	// Several owners might claim the same prefix. It is announced for the
+	// one that takes precedence, by the store of its route.
+	previous := s.claims.winner(key).route
+	if s.claims.claims[key] == nil {
+		s.claims.claims[key] = map[string]claim{}
+	}
+	_, claimed := s.claims.claims[key][claimant(route)]
+	s.claims.claims[key][claimant(route)] = claim{route: route, store: s}
+	c := s.claims.winner(key)
+	winner := c.route
+
+	if err := c.store.add(key, winner); err != nil {
+		return err
+	}
+
+	// Only new conflicts are reported.
+	if routeOwner(winner) != owner {
+		if !claimed || routeOwner(previous) == owner {
+			glog.Errorf("Conflict    %s. Prefix is announced for %s\n", s.route(route), routeOwner(winner))
+			return &ConflictError{Route: route, Winner: winner}
+		}
+		return nil
+	}
+	if previous != nil && routeOwner(previous) != owner {
+		glog.Errorf("Conflict    %s. Prefix is announced for %s\n", s.route(previous), owner)
+		return &ConflictError{Route: previous, Winner: route}
+	}
+	return nil
+}
+
+// add announces the route, or updates the announcement of its prefix, also
+// if it was announced by another store so far. The caller must hold the
+// routes lock.
+func (s *RoutesStore) add(key string, route RouteInterface) error {
+	announced := s.takeOver(key)
+	if obj, exists, _ := s.Store.GetByKey(key); exists {
+		announced = obj.(RouteInterface)
+	}
+	if announced != nil {
+		s.cancel(key)
+		if samePathAttributes(s.route(announced), s.route(route)) {
+			// The owner of the prefix might have changed.
+			return s.Store.Update(route)
 		}
+		return s.announce(route, true)
+	}
 
+	if delay := s.server.holdDown.AnnounceDelay; delay > 0 {
+		if t, ok := s.pending[key]; ok {
+			t.route = route
+			return nil
+		}
+		s.hold(key, route, false, delay)
+		return nil
+	}
+
+	return s.announce(route, false)
+}
+
+// takeOver makes the other stores sharing the claims forget about a prefix,
+// because its new winner belongs to this store. The route they announced
+// is returned, so announcing the winner replaces it without a withdraw. The
+// caller must hold the routes lock.
+func (s *RoutesStore) takeOver(key string) (announced RouteInterface) {
+	for _, other := range s.claims.stores {
+		if other == s {
+			continue
+		}
+		if t, ok := other.pending[key]; ok {
+			if t.withdraw {
+				other.cancel(key)
+			} else {
+				t.timer.Stop()
+				delete(other.pending, key)
+			}
+		}
+		if obj, exists, _ := other.Store.GetByKey(key); exists {
+			announced = obj.(RouteInterface)
+			other.Store.Delete(obj)
+		}
+	}
+	return announced
+}
+
+func (s *RoutesStore) announce(route RouteInterface, exists bool) error {
+	// While routes are withdrawn, the store still tracks them, so they can
+	// be announced again later.
+	if s.withdrawn {
+		glog.V(3).Infof("Not announcing %s. All routes are withdrawn", s.route(route))
 		return s.Store.Add(route)
 	}
 
-	return nil
+	// Announcing an existing prefix again implicitly replaces the
+	// previous path, so attribute changes don't need a withdraw.
+	if exists {
+		glog.Infof("Updating    %s\n", s.route(route))
+	} else {
+		glog.Infof("Announcing  %s\n", s.route(route))
+	}
+
+	if err := s.server.speaker.Announce(s.route(route)); err != nil {
+		return err
+	}
+
+	return s.Store.Add(route)
+}
+
+// refuse keeps track of a route refused by the prefix policy. Only the
+// first refusal is reported as an error. The caller must hold the routes
+// lock.
+func (s *RoutesStore) refuse(key string, route RouteInterface) error {
+	if _, ok := s.refused[key]; ok {
+		s.refused[key] = route
+		return nil
+	}
+
+	glog.Errorf("Refusing    %s. Prefix isn't allowed\n", s.route(route))
+	s.refused[key] = route
+	s.server.refusals++
+	return &RefusedError{Route: route}
+}
+
+// List returns the announced routes, the ones waiting to be announced, the
+// ones refused by the prefix policy and the ones that lost their prefix to
+// another owner.
+func (s *RoutesStore) List() []interface{} {
+	s.server.routesMu.Lock()
+	defer s.server.routesMu.Unlock()
+
+	routes := s.Store.List()
+	for _, t := range s.pending {
+		if !t.withdraw {
+			routes = append(routes, t.route)
+		}
+	}
+	for _, route := range s.refused {
+		routes = append(routes, route)
+	}
+	for key, claims := range s.claims.claims {
+		winner := claimant(s.claims.winner(key).route)
+		for id, c := range claims {
+			if c.store == s && id != winner {
+				routes = append(routes, c.route)
+			}
+		}
+	}
+	return routes
+}
+
+// hold delays the announcement or withdrawal of a route. The caller must
+// hold the routes lock.
+func (s *RoutesStore) hold(key string, route RouteInterface, withdraw bool, delay time.Duration) {
+	t := &transition{withdraw: withdraw, route: route, since: time.Now()}
+	glog.Infof("Holding     %s for %s (%s)\n", s.route(route), delay, t)
+
+	t.timer = time.AfterFunc(delay, func() { s.complete(key, t) })
+	s.pending[key] = t
+}
+
+// complete carries out a transition once its hold-down passed.
+func (s *RoutesStore) complete(key string, t *transition) {
+	s.server.routesMu.Lock()
+	defer s.server.routesMu.Unlock()
+
+	if s.pending[key] != t {
+		return
+	}
+	delete(s.pending, key)
+
+	var err error
+	if t.withdraw {
+		err = s.remove(t.route)
+	} else {
+		err = s.announce(t.route, false)
+	}
+	if err != nil {
+		glog.Errorf("Couldn't complete %s of %s: %s", t, s.route(t.route), err)
+	}
+}
+
+// cancel drops a pending transition of a route, because the route changed
+// back before its hold-down passed. The caller must hold the routes lock.
+func (s *RoutesStore) cancel(key string) {
+	t, ok := s.pending[key]
+	if !ok {
+		return
+	}
+
+	glog.Infof("Cancelled   %s after %s (%s)\n", s.route(t.route), time.Since(t.since).Round(time.Second), t)
+	t.timer.Stop()
+	delete(s.pending, key)
+	s.server.cancelledTransitions++
+}
+
+// pendingTransitions counts the held down announcements and withdrawals.
+// The caller must hold the routes lock.
+func (s *RoutesStore) pendingTransitions() (announcements, withdrawals int) {
+	for _, t := range s.pending {
+		if t.withdraw {
+			withdrawals++
+		} else {
+			announcements++
+		}
+	}
+	return announcements, withdrawals
 }
 
+func (s *RoutesStore) route(route RouteInterface) Route {
+	return Route{RouteInterface: route, LocalAS: s.server.as, Depreference: s.depreference}
+}
+
+// samePathAttributes checks whether two routes for the same prefix would be
+// announced with identical path attributes.
+func samePathAttributes(a, b Route) bool {
+	attrsA, attrsB := a.Path(false).GetPathAttrs(), b.Path(false).GetPathAttrs()
+	if len(attrsA) != len(attrsB) {
+		return false
+	}
+
+	for i := range attrsA {
+		bytesA, errA := attrsA[i].Serialize()
+		bytesB, errB := attrsB[i].Serialize()
+		if errA != nil || errB != nil || !bytes.Equal(bytesA, bytesB) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Delete withdraws a route right away, e.g. because its service was deleted
+// or doesn't have the IP anymore. A held down withdrawal of the route is
+// completed.
 func (s *RoutesStore) Delete(route RouteInterface) error {
+	s.server.routesMu.Lock()
+	defer s.server.routesMu.Unlock()
+
+	return s.delete(route, false)
+}
+
+// DeleteHeldDown withdraws a route that is only unwanted for now, because
+// its service has no serving endpoints or failed its health check. The
+// withdrawal is held down for the WithdrawDelay.
+func (s *RoutesStore) DeleteHeldDown(route RouteInterface) error {
+	s.server.routesMu.Lock()
+	defer s.server.routesMu.Unlock()
+
+	return s.delete(route, true)
+}
+
+func (s *RoutesStore) delete(route RouteInterface, holdDown bool) error {
+	key, _ := RouteKeyFunc(route)
+	owner := routeOwner(route)
+	if _, ok := s.refused[key+" "+owner]; ok {
+		delete(s.refused, key+" "+owner)
+		return nil
+	}
+
+	// The prefix is handed over if other owners still claim it, maybe
+	// with a route of another store.
+	if claims, ok := s.claims.claims[key]; ok {
+		id := claimant(route)
+		if _, ok := claims[id]; !ok {
+			return nil
+		}
+		previous := claimant(s.claims.winner(key).route)
+		delete(claims, id)
+		if len(claims) > 0 {
+			winner := s.claims.winner(key)
+			if previous == id {
+				glog.Infof("Handing over %s to %s\n", s.route(route), routeOwner(winner.route))
+			}
+			return winner.store.add(key, winner.route)
+		}
+		delete(s.claims.claims, key)
+	}
+
+	if t, ok := s.pending[key]; ok && !t.withdraw {
+		s.cancel(key)
+		return nil
+	}
+
 	if _, exists, _ := s.Store.Get(route); exists {
-		glog.Infof("Withdrawing %s\n", Route{route})
+		if delay := s.server.holdDown.WithdrawDelay; holdDown && delay > 0 {
+			if _, ok := s.pending[key]; !ok {
+				s.hold(key, route, true, delay)
+			}
+			return nil
+		}
 
-		if err := s.server.bgp.DeletePath(nil, bgp.RF_IPv4_UC, "", []*table.Path{Route{route}.Path(true)}); err != nil {
-			return fmt.Errorf("Oops. Something went wrong deleting route: %s", err)
+		if t, ok := s.pending[key]; ok {
+			t.timer.Stop()
+			delete(s.pending, key)
 		}
+		return s.remove(route)
+	}
+
+	return nil
+}
 
-		return s.Store.Delete(route)
+// remove withdraws a route and forgets about it. The caller must hold the
+// routes lock.
+func (s *RoutesStore) remove(route RouteInterface) error {
+	if _, exists, _ := s.Store.Get(route); !exists {
+		return nil
+	}
+
+	if !s.withdrawn {
+		if err := s.withdraw(route); err != nil {
+			return err
+		}
 	}
 
+	return s.Store.Delete(route)
+}
+
+func (s *RoutesStore) withdraw(route RouteInterface) error {
+	glog.Infof("Withdrawing %s\n", s.route(route))
+
+	return s.server.speaker.Withdraw(s.route(route))
+}
+
+// deprefer announces all routes again with the given depreference, unless
+// they are withdrawn. The caller must hold the routes lock.
+func (s *RoutesStore) deprefer(d Depreference) error {
+	if s.depreference == d {
+		return nil
+	}
+	s.depreference = d
+
+	if s.withdrawn {
+		return nil
+	}
+	return s.announceAll()
+}
+
+// setWithdrawn withdraws all routes or announces them again. The caller
+// must hold the routes lock.
+func (s *RoutesStore) setWithdrawn(withdrawn bool) error {
+	if s.withdrawn == withdrawn {
+		return nil
+	}
+	s.withdrawn = withdrawn
+
+	if withdrawn {
+		return s.withdrawAll()
+	}
+	return s.announceAll()
+}
+
+// announceAll announces all routes again, e.g. after the depreference
+// changed. The caller must hold the routes lock.
+func (s *RoutesStore) announceAll() error {
+	for _, obj := range s.Store.List() {
+		glog.Infof("Announcing  %s\n", s.route(obj.(RouteInterface)))
+		if err := s.server.speaker.Announce(s.route(obj.(RouteInterface))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withdrawAll withdraws all routes, but keeps them in the store. The caller
+// must hold the routes lock.
+func (s *RoutesStore) withdrawAll() error {
+	for _, obj := range s.Store.List() {
+		if err := s.withdraw(obj.(RouteInterface)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -78,14 +486,37 @@ func (s *ExternalIPRoutesStore) List() (routes []ExternalIPRoute) {
 	return routes
 }
 
-func (s *ExternalIPRoutesStore) Add(service *v1.Service, hostIP *net.IP) error {
-	return s.store.Add(NewExternalIPRoute(service, hostIP))
+func (s *ExternalIPRoutesStore) Add(service *v1.Service, externalIP string, hostIP *net.IP, terminating bool) error {
+	return s.store.Add(NewExternalIPRoute(service, externalIP, hostIP, terminating))
 }
 
 func (s *ExternalIPRoutesStore) Delete(route ExternalIPRoute) error {
 	return s.store.Delete(route)
 }
 
+func (s *ExternalIPRoutesStore) DeleteHeldDown(route ExternalIPRoute) error {
+	return s.store.DeleteHeldDown(route)
+}
+
+func (s *LoadBalancerIPRoutesStore) List() (routes []LoadBalancerIPRoute) {
+	for _, m := range s.store.List() {
+		routes = append(routes, m.(LoadBalancerIPRoute))
+	}
+	return routes
+}
+
+func (s *LoadBalancerIPRoutesStore) Add(service *v1.Service, ingressIP string, hostIP *net.IP, terminating bool) error {
+	return s.store.Add(NewLoadBalancerIPRoute(service, ingressIP, hostIP, terminating))
+}
+
+func (s *LoadBalancerIPRoutesStore) Delete(route LoadBalancerIPRoute) error {
+	return s.store.Delete(route)
+}
+
+func (s *LoadBalancerIPRoutesStore) DeleteHeldDown(route LoadBalancerIPRoute) error {
+	return s.store.DeleteHeldDown(route)
+}
+
 func (s *NodePodSubnetRoutesStore) List() (routes []NodePodSubnetRoute) {
 	for _, m := range s.store.List() {
 		routes = append(routes, m.(NodePodSubnetRoute))
@@ -93,8 +524,8 @@ func (s *NodePodSubnetRoutesStore) List() (routes []NodePodSubnetRoute) {
 	return routes
 }
 
-func (s *NodePodSubnetRoutesStore) Add(node *v1.Node) error {
-	return s.store.Add(NewNodePodSubnetRoute(node))
+func (s *NodePodSubnetRoutesStore) Add(node *v1.Node, subnet string) error {
+	return s.store.Add(NewNodePodSubnetRoute(node, subnet))
 }
 
 func (s *NodePodSubnetRoutesStore) Delete(route NodePodSubnetRoute) error {
@@ -0,0 +1,163 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sapcc/kube-parrot/pkg/bgp"
+	"github.com/sapcc/kube-parrot/pkg/forked/informer"
+	reconciler "github.com/sapcc/kube-parrot/pkg/util"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	AnnotationDrain = "parrot.sap.cc/drain"
+)
+
+// DrainOptions configure how the local node is drained.
+type DrainOptions struct {
+	// Taint marks the node as draining, in addition to cordoning it or
+	// annotating it with parrot.sap.cc/drain=true. Disabled if empty.
+	Taint string
+	// Depreference is applied as soon as the node starts draining.
+	Depreference bgp.Depreference
+	// Time is how long routes stay depreferred before they are withdrawn.
+	Time time.Duration
+}
+
+// NodeDrainController moves traffic away from the local node while it is
+// drained for maintenance. Routes of services are depreferred first and
+// withdrawn after the drain time. Once the node isn't draining anymore,
+// they are announced as usual again. Pod subnet routes aren't touched, as
+// pods keep running on a cordoned node.
+type NodeDrainController struct {
+	server     *bgp.Server
+	nodeName   string
+	options    DrainOptions
+	reconciler reconciler.DirtyReconcilerInterface
+
+	nodes         cache.Store
+	drainingSince time.Time
+	// withdrawTimer reconciles once the drain time passed.
+	withdrawTimer *time.Timer
+}
+
+func NewNodeDrainController(informers informer.SharedInformerFactory, nodeName string,
+	server *bgp.Server, options DrainOptions) *NodeDrainController {
+
+	c := &NodeDrainController{
+		server:   server,
+		nodeName: nodeName,
+		options:  options,
+		nodes:    cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc),
+	}
+
+	c.reconciler = reconciler.NewNamedDirtyReconciler("drain", c.reconcile)
+
+	informers.Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.nodeAdd,
+		UpdateFunc: c.nodeUpdate,
+		DeleteFunc: c.nodeDelete,
+	})
+
+	return c
+}
+
+func (c *NodeDrainController) Run(stopCh <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	wg.Add(1)
+
+	c.reconciler.Run(stopCh)
+
+	<-stopCh
+}
+
+// Reconciled is closed once the drain state was applied for the first time.
+func (c *NodeDrainController) Reconciled() <-chan struct{} {
+	return c.reconciler.Reconciled()
+}
+
+func (c *NodeDrainController) nodeAdd(obj interface{}) {
+	node := obj.(*v1.Node)
+	if node.Name != c.nodeName {
+		return
+	}
+
+	c.nodes.Update(node)
+	c.reconciler.Dirty()
+}
+
+func (c *NodeDrainController) nodeUpdate(old, cur interface{}) {
+	c.nodeAdd(cur)
+}
+
+func (c *NodeDrainController) nodeDelete(obj interface{}) {
+	node, ok := obj.(*v1.Node)
+	if !ok || node.Name != c.nodeName {
+		return
+	}
+
+	c.nodes.Delete(node)
+	c.reconciler.Dirty()
+}
+
+func (c *NodeDrainController) reconcile() error {
+	obj, exists, _ := c.nodes.GetByKey(c.nodeName)
+	if !exists || !c.isDraining(obj.(*v1.Node)) {
+		if !c.drainingSince.IsZero() {
+			glog.Infof("Node %s isn't draining anymore. Announcing routes", c.nodeName)
+			c.drainingSince = time.Time{}
+		}
+		if c.withdrawTimer != nil {
+			c.withdrawTimer.Stop()
+		}
+		if err := c.server.SetWithdrawn(false); err != nil {
+			return err
+		}
+		return c.server.Deprefer(bgp.Depreference{})
+	}
+
+	if c.drainingSince.IsZero() {
+		glog.Infof("Node %s is draining. Withdrawing routes in %s", c.nodeName, c.options.Time)
+		c.drainingSince = time.Now()
+	}
+
+	if err := c.server.Deprefer(c.options.Depreference); err != nil {
+		return err
+	}
+
+	if remaining := c.options.Time - time.Since(c.drainingSince); remaining > 0 {
+		if c.withdrawTimer == nil {
+			c.withdrawTimer = time.AfterFunc(remaining, c.reconciler.Dirty)
+		} else {
+			c.withdrawTimer.Reset(remaining)
+		}
+		return nil
+	}
+
+	return c.server.SetWithdrawn(true)
+}
+
+// isDraining checks whether the node is cordoned, tainted with the drain
+// taint or annotated for draining.
+func (c *NodeDrainController) isDraining(node *v1.Node) bool {
+	if node.Spec.Unschedulable || node.Annotations[AnnotationDrain] == "true" {
+		return true
+	}
+
+	if c.options.Taint != "" {
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == c.options.Taint {
+				return true
+			}
+		}
+	}
+
+	return false
+}
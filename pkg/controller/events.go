@@ -0,0 +1,57 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const eventComponent = "kube-parrot"
+
+// serviceEventf creates an Event on a service in the background. Failures
+// are only logged.
+func serviceEventf(client kubernetes.Interface, nodeName string, svc *v1.Service, eventType, reason, messageFmt string, args ...interface{}) {
+	if client == nil || svc == nil {
+		return
+	}
+
+	now := metav1.NewTime(time.Now())
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: svc.Name + ".",
+			Namespace:    svc.Namespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:            "Service",
+			APIVersion:      "v1",
+			Namespace:       svc.Namespace,
+			Name:            svc.Name,
+			UID:             svc.UID,
+			ResourceVersion: svc.ResourceVersion,
+		},
+		Reason:              reason,
+		Message:             fmt.Sprintf(messageFmt, args...),
+		Type:                eventType,
+		Source:              v1.EventSource{Component: eventComponent, Host: nodeName},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: eventComponent,
+		ReportingInstance:   eventComponent + "-" + nodeName,
+	}
+
+	go func() {
+		if _, err := client.CoreV1().Events(svc.Namespace).Create(context.TODO(), event, metav1.CreateOptions{}); err != nil {
+			glog.Errorf("Couldn't create event %s for service %s/%s: %s", reason, svc.Namespace, svc.Name, err)
+		}
+	}()
+}
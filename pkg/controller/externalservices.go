@@ -11,40 +11,77 @@ import (
 	"github.com/golang/glog"
 	"github.com/sapcc/kube-parrot/pkg/bgp"
 	"github.com/sapcc/kube-parrot/pkg/forked/informer"
+	"github.com/sapcc/kube-parrot/pkg/healthcheck"
+	"github.com/sapcc/kube-parrot/pkg/types"
 	reconciler "github.com/sapcc/kube-parrot/pkg/util"
 
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 )
 
 type ExternalServicesController struct {
-	routes     *bgp.ExternalIPRoutesStore
-	reconciler reconciler.DirtyReconcilerInterface
-	hostIP     *net.IP
-	nodeName   string
+	client             kubernetes.Interface
+	routes             *bgp.ExternalIPRoutesStore
+	loadBalancerRoutes *bgp.LoadBalancerIPRoutesStore
+	reconciler         reconciler.DirtyReconcilerInterface
+	hostIP             *net.IP
+	hostIPv6           *net.IP
+	nodeName           string
+	loadBalancerClass  string
+	healthChecks       HealthChecker
+	selector           ServiceSelector
 
-	services  cache.Store
-	endpoints cache.Store
-	proxies   cache.Store
+	services       cache.Store
+	endpointSlices cache.Indexer
+	proxy          *KubeProxyWatchdog
+
+	allServices *informer.StoreToServiceLister
+	namespaces  *informer.StoreToNamespaceLister
+}
+
+// HealthChecker runs the health checks configured for services, like
+// healthcheck.Checker does.
+type HealthChecker interface {
+	Healthy(key, ip string, check healthcheck.Check) bool
+	Retain(keys map[string]bool)
+	Stop()
 }
 
-func NewExternalServicesController(informers informer.SharedInformerFactory,
-	hostIP *net.IP, nodeName string, routes *bgp.ExternalIPRoutesStore) *ExternalServicesController {
+func NewExternalServicesController(informers informer.SharedInformerFactory, client kubernetes.Interface,
+	hostIP, hostIPv6 *net.IP, nodeName string, loadBalancerClass string,
+	routes *bgp.ExternalIPRoutesStore, loadBalancerRoutes *bgp.LoadBalancerIPRoutesStore,
+	proxy *KubeProxyWatchdog, selector ServiceSelector) *ExternalServicesController {
 
 	c := &ExternalServicesController{
-		routes:    routes,
-		hostIP:    hostIP,
-		nodeName:  nodeName,
-		services:  cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc),
-		endpoints: cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc),
+		client:             client,
+		routes:             routes,
+		loadBalancerRoutes: loadBalancerRoutes,
+		hostIP:             hostIP,
+		hostIPv6:           hostIPv6,
+		nodeName:           nodeName,
+		loadBalancerClass:  loadBalancerClass,
+		proxy:              proxy,
+		selector:           selector,
+		allServices:        informers.Services().Lister(),
+		services:           cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc),
+		endpointSlices: cache.NewIndexer(cache.DeletionHandlingMetaNamespaceKeyFunc, cache.Indexers{
+			informer.EndpointSliceServiceIndex: informer.EndpointSliceServiceIndexFunc,
+		}),
 	}
 
 	c.reconciler = reconciler.NewNamedDirtyReconciler("externalips", c.reconcile)
+	c.healthChecks = healthcheck.NewChecker(*hostIP, types.KubeProxyHealthzPort, c.reconciler.Dirty)
+	if proxy != nil {
+		proxy.OnChange(c.reconciler.Dirty)
+	}
 
-	informers.Endpoints().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    c.endpointsAdd,
-		UpdateFunc: c.endpointsUpdate,
-		DeleteFunc: c.endpointsDelete,
+	informers.EndpointSlices().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.endpointSliceAdd,
+		UpdateFunc: c.endpointSliceUpdate,
+		DeleteFunc: c.endpointSliceDelete,
 	})
 
 	informers.Services().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -53,6 +90,15 @@ func NewExternalServicesController(informers informer.SharedInformerFactory,
 		DeleteFunc: c.serviceDelete,
 	})
 
+	// Namespaces are only watched if they are selected by their labels.
+	if selector.Namespaces != nil {
+		c.namespaces = informers.Namespaces().Lister()
+		informers.Namespaces().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.namespaceAdd,
+			UpdateFunc: c.namespaceUpdate,
+		})
+	}
+
 	return c
 }
 
@@ -63,6 +109,19 @@ func (c *ExternalServicesController) Run(stopCh <-chan struct{}, wg *sync.WaitGr
 	c.reconciler.Run(stopCh)
 
 	<-stopCh
+	c.healthChecks.Stop()
+}
+
+// SetHealthChecker replaces the checker probing the services from this
+// node. It must be called before Run.
+func (c *ExternalServicesController) SetHealthChecker(checker HealthChecker) {
+	c.healthChecks.Stop()
+	c.healthChecks = checker
+}
+
+// Reconciled is closed once all routes have been announced for the first time.
+func (c *ExternalServicesController) Reconciled() <-chan struct{} {
+	return c.reconciler.Reconciled()
 }
 
 func (c *ExternalServicesController) serviceDelete(obj interface{}) {
@@ -74,8 +133,76 @@ func (c *ExternalServicesController) serviceDelete(obj interface{}) {
 
 func (c *ExternalServicesController) serviceAdd(obj interface{}) {
 	service := obj.(*v1.Service)
-	if len(service.Spec.ExternalIPs) == 0 {
-		glog.V(3).Infof("Skipping service %v. No externalIP defined...", service.GetName())
+	c.reportInvalidIPs(service)
+	c.reportInvalidAnnotations(service)
+	c.addService(service)
+}
+
+// reportInvalidIPs emits an event for every IP of the service that can't be
+// parsed. These IPs are ignored.
+func (c *ExternalServicesController) reportInvalidIPs(service *v1.Service) {
+	ips := append([]string{}, service.Spec.ExternalIPs...)
+	if c.isLoadBalancer(service) {
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				ips = append(ips, ingress.IP)
+			}
+		}
+	}
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			glog.Errorf("Ignoring invalid IP %q of service %s/%s", ip, service.Namespace, service.Name)
+			serviceEventf(c.client, c.nodeName, service, v1.EventTypeWarning, "InvalidIP", "Ignoring invalid IP %q", ip)
+		}
+	}
+}
+
+// reportInvalidAnnotations emits an event for every invalid annotation of
+// a selected service. Invalid annotations are ignored, the valid ones are
+// applied nonetheless.
+func (c *ExternalServicesController) reportInvalidAnnotations(service *v1.Service) {
+	if !c.selector.Matches(service, c.namespaces) {
+		return
+	}
+
+	report := func(what string, err error) {
+		// Errors of several annotations are reported on a single line.
+		msg := strings.ReplaceAll(err.Error(), "\n", "; ")
+		glog.Errorf("Ignoring invalid %s of service %s/%s: %s", what, service.Namespace, service.Name, msg)
+		serviceEventf(c.client, c.nodeName, service, v1.EventTypeWarning, "InvalidAnnotation", "Ignoring invalid %s: %s", what, msg)
+	}
+	if _, err := bgp.ServiceAttributes(service); err != nil {
+		report("path attribute annotations", err)
+	}
+	if _, _, err := bgp.TerminatingEndpoints(service); err != nil {
+		report(bgp.AnnotationTerminatingDeprefer, err)
+	}
+	if _, err := bgp.ServicePriority(service); err != nil {
+		report(bgp.AnnotationPriority, err)
+	}
+	if _, err := healthcheck.ServiceCheck(service); err != nil {
+		report("health check annotations", err)
+	}
+}
+
+func (c *ExternalServicesController) addService(service *v1.Service) {
+	if len(externalIPs(service)) == 0 && len(c.loadBalancerIPs(service)) == 0 {
+		glog.V(3).Infof("Skipping service %v. No externalIP or loadBalancer ingress IP defined...", service.GetName())
+		if _, exists, _ := c.services.Get(service); exists {
+			glog.V(3).Infof("Deleting Service (%s)", service.Name)
+			c.services.Delete(service)
+			c.reconciler.Dirty()
+		}
+		return
+	}
+
+	if !c.selector.Matches(service, c.namespaces) {
+		glog.V(3).Infof("Skipping service %s/%s. Not selected for announcement...", service.Namespace, service.Name)
+		if _, exists, _ := c.services.Get(service); exists {
+			glog.V(3).Infof("Deleting Service (%s)", service.Name)
+			c.services.Delete(service)
+			c.reconciler.Dirty()
+		}
 		return
 	}
 
@@ -88,110 +215,352 @@ func (c *ExternalServicesController) serviceAdd(obj interface{}) {
 	c.reconciler.Dirty()
 }
 
+// serviceUpdate withdraws the routes of IPs removed from the service right
+// away, instead of waiting for the next reconcile.
 func (c *ExternalServicesController) serviceUpdate(old, cur interface{}) {
-	c.serviceAdd(cur)
-}
+	oldSvc, curSvc := old.(*v1.Service), cur.(*v1.Service)
 
-func (c *ExternalServicesController) endpointsDelete(obj interface{}) {
-	endpoints := obj.(*v1.Endpoints)
+	removed := removedIPs(externalIPs(oldSvc), externalIPs(curSvc))
+	for _, route := range c.routes.List() {
+		if isService(route.Service, curSvc) && containsIP(removed, route.ExternalIP) {
+			glog.V(3).Infof("ExternalIP %s removed from Service (%s)", route.ExternalIP, curSvc.Name)
+			if err := c.routes.Delete(route); err != nil {
+				glog.Errorf("Couldn't withdraw ExternalIP %s of Service (%s): %s", route.ExternalIP, curSvc.Name, err)
+			}
+		}
+	}
 
-	if _, exists, _ := c.endpoints.Get(endpoints); exists {
-		glog.V(3).Infof("Deleting Endpoints (%s/%s)", endpoints.Namespace, endpoints.Name)
-		c.endpoints.Delete(endpoints)
-		c.reconciler.Dirty()
+	removed = removedIPs(c.loadBalancerIPs(oldSvc), c.loadBalancerIPs(curSvc))
+	for _, route := range c.loadBalancerRoutes.List() {
+		if isService(route.Service, curSvc) && containsIP(removed, route.IngressIP) {
+			glog.V(3).Infof("LoadBalancer ingress IP %s removed from Service (%s)", route.IngressIP, curSvc.Name)
+			if err := c.loadBalancerRoutes.Delete(route); err != nil {
+				glog.Errorf("Couldn't withdraw LoadBalancer ingress IP %s of Service (%s): %s", route.IngressIP, curSvc.Name, err)
+			}
+		}
 	}
+
+	// Routes that couldn't be withdrawn are retried by the reconcile. Resyncs
+	// don't report invalid IPs and annotations again.
+	if oldSvc.ResourceVersion != curSvc.ResourceVersion {
+		c.reportInvalidIPs(curSvc)
+		c.reportInvalidAnnotations(curSvc)
+	}
+	c.addService(curSvc)
 }
 
-func (c *ExternalServicesController) endpointsAdd(obj interface{}) {
-	endpoints := obj.(*v1.Endpoints)
+// namespaceAdd reevaluates the services of a namespace, as it might be
+// selected or deselected by its labels.
+func (c *ExternalServicesController) namespaceAdd(obj interface{}) {
+	ns := obj.(*v1.Namespace)
+	services, err := c.allServices.Services(ns.Name).List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Couldn't list services of namespace %s: %s", ns.Name, err)
+		return
+	}
+	for _, service := range services {
+		c.addService(service)
+	}
+}
 
-	ready := false
-	for _, v := range endpoints.Subsets {
-		if len(v.Addresses) > 0 {
-			ready = true
-			break
-		}
+func (c *ExternalServicesController) namespaceUpdate(old, cur interface{}) {
+	oldNs, curNs := old.(*v1.Namespace), cur.(*v1.Namespace)
+	if labels.Equals(oldNs.Labels, curNs.Labels) {
+		return
 	}
+	c.namespaceAdd(cur)
+}
 
-	if ready {
-		glog.V(5).Infof("Endpoint is ready (%s)", endpoints.Name)
-		if _, exists, _ := c.endpoints.Get(endpoints); !exists {
-			glog.V(3).Infof("Adding Endpoints (%s/%s)", endpoints.Namespace, endpoints.Name)
-			c.endpoints.Add(endpoints)
-			c.reconciler.Dirty()
-		} else {
-			c.endpoints.Update(endpoints) // update the endpoints object in the cache
+func (c *ExternalServicesController) endpointSliceDelete(obj interface{}) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
 		}
-	} else {
-		if !strings.HasSuffix(endpoints.Name, "kube-scheduler") &&
-			!strings.HasSuffix(endpoints.Name, "kube-controller-manager") {
-			glog.V(5).Infof("Endpoint is NOT ready (%s)", endpoints.Name)
-		}
-		if _, exists, _ := c.endpoints.Get(endpoints); exists {
-			glog.V(3).Infof("Deleting Endpoints (%s/%s)", endpoints.Namespace, endpoints.Name)
-			c.endpoints.Delete(endpoints)
-			c.reconciler.Dirty()
+		if slice, ok = tombstone.Obj.(*discoveryv1.EndpointSlice); !ok {
+			return
 		}
 	}
+
+	if _, exists, _ := c.endpointSlices.Get(slice); exists {
+		glog.V(3).Infof("Deleting EndpointSlice (%s/%s)", slice.Namespace, slice.Name)
+		c.endpointSlices.Delete(slice)
+		c.reconciler.Dirty()
+	}
 }
 
-func (c *ExternalServicesController) endpointsUpdate(old, cur interface{}) {
-	c.endpointsAdd(cur)
+func (c *ExternalServicesController) endpointSliceAdd(obj interface{}) {
+	slice := obj.(*discoveryv1.EndpointSlice)
+	if _, ok := slice.Labels[discoveryv1.LabelServiceName]; !ok {
+		return
+	}
+
+	if _, exists, _ := c.endpointSlices.Get(slice); !exists {
+		glog.V(3).Infof("Adding EndpointSlice (%s/%s)", slice.Namespace, slice.Name)
+		c.endpointSlices.Add(slice)
+	} else {
+		c.endpointSlices.Update(slice) // update the EndpointSlice object in the cache
+	}
 	c.reconciler.Dirty()
 }
 
+func (c *ExternalServicesController) endpointSliceUpdate(old, cur interface{}) {
+	c.endpointSliceAdd(cur)
+}
+
 func (c *ExternalServicesController) reconcile() error {
+	// Traffic to service IPs is blackholed while kube-proxy doesn't program
+	// the dataplane. The routes are announced again once it recovered.
+	if c.proxy != nil && !c.proxy.Healthy() {
+		return c.withdrawAll()
+	}
+
+	// Routes of services that lost their endpoints or health are withdrawn
+	// after the hold-down, others right away.
 	for _, route := range c.routes.List() {
-		obj, svcFound, _ := c.services.Get(route.Service)
-		if !svcFound {
-			if err := c.routes.Delete(route); err != nil {
-				return err
-			}
+		configured, wanted := c.isAnnounced(route.Service, route.ExternalIP, externalIPs)
+		var err error
+		if !configured {
+			err = c.routes.Delete(route)
+		} else if !wanted {
+			err = c.routes.DeleteHeldDown(route)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, route := range c.loadBalancerRoutes.List() {
+		configured, wanted := c.isAnnounced(route.Service, route.IngressIP, c.loadBalancerIPs)
+		var err error
+		if !configured {
+			err = c.loadBalancerRoutes.Delete(route)
+		} else if !wanted {
+			err = c.loadBalancerRoutes.DeleteHeldDown(route)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	healthChecks := map[string]bool{}
+	for _, service := range c.services.List() {
+		svc := service.(*v1.Service)
+		serving, terminating := c.servingEndpoints(svc)
+		if !serving {
 			continue
 		}
-		svc := obj.(*v1.Service)
 
-		if eps, ok, _ := c.endpoints.Get(svc); !ok {
-			if err := c.routes.Delete(route); err != nil {
-				return err
+		for _, ip := range externalIPs(svc) {
+			healthChecks[healthCheckKey(svc, ip)] = true
+			if !c.isHealthy(svc, ip) {
+				continue
 			}
-		} else if svc.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal {
-			if !hasEndpointOnNode(c.nodeName, eps.(*v1.Endpoints)) {
-				if err := c.routes.Delete(route); err != nil {
+			if nextHop := c.nextHopFor(svc, ip); nextHop != nil {
+				if err := c.routes.Add(svc, ip, nextHop, terminating); err != nil && !c.reported(err) {
 					return err
 				}
 			}
 		}
-	}
 
-	for _, service := range c.services.List() {
-		if eps, ok, _ := c.endpoints.Get(service); ok {
-			svc := service.(*v1.Service)
-
-			if svc.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal {
-				if hasEndpointOnNode(c.nodeName, eps.(*v1.Endpoints)) {
-					if err := c.routes.Add(svc, c.hostIP); err != nil {
-						return err
-					}
-				}
-			} else {
-				if err := c.routes.Add(svc, c.hostIP); err != nil {
+		for _, ip := range c.loadBalancerIPs(svc) {
+			healthChecks[healthCheckKey(svc, ip)] = true
+			if !c.isHealthy(svc, ip) {
+				continue
+			}
+			if nextHop := c.nextHopFor(svc, ip); nextHop != nil {
+				if err := c.loadBalancerRoutes.Add(svc, ip, nextHop, terminating); err != nil && !c.reported(err) {
 					return err
 				}
 			}
 		}
 	}
+	c.healthChecks.Retain(healthChecks)
 
 	return nil
 }
 
-func hasEndpointOnNode(nodeName string, eps *v1.Endpoints) bool {
-	for _, subset := range eps.Subsets {
-		for _, address := range subset.Addresses {
-			if *address.NodeName == nodeName {
-				return true
+// reported reports routes that were refused by the prefix policy or lost
+// their prefix to another service. Other errors aren't handled.
+func (c *ExternalServicesController) reported(err error) bool {
+	switch e := err.(type) {
+	case *bgp.RefusedError:
+		serviceEventf(c.client, c.nodeName, bgp.RouteService(e.Route), v1.EventTypeWarning, "PrefixRefused", "Route not announced: %s", e)
+		return true
+	case *bgp.ConflictError:
+		serviceEventf(c.client, c.nodeName, bgp.RouteService(e.Route), v1.EventTypeWarning, "PrefixConflict", "Route not announced: %s", e)
+		return true
+	}
+	return false
+}
+
+func (c *ExternalServicesController) withdrawAll() error {
+	for _, route := range c.routes.List() {
+		if err := c.routes.Delete(route); err != nil {
+			return err
+		}
+	}
+	for _, route := range c.loadBalancerRoutes.List() {
+		if err := c.loadBalancerRoutes.Delete(route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isAnnounced checks whether the route for ip of the given service is still
+// configured, i.e. the service is selected and has the IP, and whether it is
+// wanted, i.e. the service also has serving endpoints and is healthy. It uses
+// the current state of the service from the cache.
+func (c *ExternalServicesController) isAnnounced(service *v1.Service, ip string, ips func(*v1.Service) []string) (configured, wanted bool) {
+	obj, svcFound, _ := c.services.Get(service)
+	if !svcFound {
+		return false, false
+	}
+	svc := obj.(*v1.Service)
+
+	if !containsIP(ips(svc), ip) {
+		return false, false
+	}
+
+	serving, _ := c.servingEndpoints(svc)
+	return true, serving && c.isHealthy(svc, ip)
+}
+
+// isHealthy checks whether the health check configured for the service
+// passes for ip on this node. Services without a valid check are healthy.
+func (c *ExternalServicesController) isHealthy(svc *v1.Service, ip string) bool {
+	check, err := healthcheck.ServiceCheck(svc)
+	if err != nil || check == nil {
+		return true
+	}
+	return c.healthChecks.Healthy(healthCheckKey(svc, ip), ip, *check)
+}
+
+// servingEndpoints checks whether the service has endpoints that traffic
+// arriving at this node can be sent to. If the service opted in, endpoints
+// that are terminating, but still serving count, too. terminating is set if
+// these are the only ones.
+func (c *ExternalServicesController) servingEndpoints(svc *v1.Service) (serving, terminating bool) {
+	slices, err := c.endpointSlices.ByIndex(informer.EndpointSliceServiceIndex, svc.Namespace+"/"+svc.Name)
+	if err != nil {
+		return false, false
+	}
+
+	serveTerminating, _, _ := bgp.TerminatingEndpoints(svc)
+	local := svc.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyTypeLocal
+	for _, obj := range slices {
+		for _, endpoint := range obj.(*discoveryv1.EndpointSlice).Endpoints {
+			if local && !isOnNode(c.nodeName, endpoint) {
+				continue
+			}
+			if isReady(endpoint) {
+				return true, false
 			}
+			if serveTerminating && isServingTerminating(endpoint) {
+				terminating = true
+			}
+		}
+	}
+
+	return terminating, terminating
+}
+
+// isLoadBalancer checks whether the service is a LoadBalancer with the
+// loadBalancerClass this controller is responsible for.
+func (c *ExternalServicesController) isLoadBalancer(svc *v1.Service) bool {
+	if c.loadBalancerClass == "" || svc.Spec.Type != v1.ServiceTypeLoadBalancer {
+		return false
+	}
+	return svc.Spec.LoadBalancerClass != nil && *svc.Spec.LoadBalancerClass == c.loadBalancerClass
+}
+
+// loadBalancerIPs returns the valid ingress IPs of a LoadBalancer service,
+// if it is one this controller is responsible for.
+func (c *ExternalServicesController) loadBalancerIPs(svc *v1.Service) (ips []string) {
+	if !c.isLoadBalancer(svc) {
+		return nil
+	}
+
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if net.ParseIP(ingress.IP) != nil {
+			ips = append(ips, ingress.IP)
+		}
+	}
+	return ips
+}
+
+// nextHopFor returns the local next hop matching the address family of ip,
+// or nil if none is configured for that family.
+func (c *ExternalServicesController) nextHopFor(svc *v1.Service, ip string) *net.IP {
+	nextHop := c.hostIP
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		nextHop = c.hostIPv6
+	}
+	if nextHop == nil || len(*nextHop) == 0 {
+		glog.V(3).Infof("Skipping %s of service %s/%s. No next hop for its address family", ip, svc.Namespace, svc.Name)
+		return nil
+	}
+	return nextHop
+}
+
+// isReady checks the ready condition of an endpoint. Consumers should
+// interpret an unknown state as ready.
+func isReady(endpoint discoveryv1.Endpoint) bool {
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
+
+// isServingTerminating checks whether a terminating endpoint still accepts
+// traffic. Without the serving condition, readiness is used instead.
+func isServingTerminating(endpoint discoveryv1.Endpoint) bool {
+	if endpoint.Conditions.Terminating == nil || !*endpoint.Conditions.Terminating {
+		return false
+	}
+	if endpoint.Conditions.Serving == nil {
+		return isReady(endpoint)
+	}
+	return *endpoint.Conditions.Serving
+}
+
+func isOnNode(nodeName string, endpoint discoveryv1.Endpoint) bool {
+	return endpoint.NodeName != nil && *endpoint.NodeName == nodeName
+}
+
+func healthCheckKey(svc *v1.Service, ip string) string {
+	return svc.Namespace + "/" + svc.Name + "/" + ip
+}
+
+// externalIPs returns the valid external IPs of a service. Invalid ones are
+// reported by reportInvalidIPs.
+func externalIPs(svc *v1.Service) (ips []string) {
+	for _, ip := range svc.Spec.ExternalIPs {
+		if net.ParseIP(ip) != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func containsIP(ips []string, ip string) bool {
+	for _, i := range ips {
+		if i == ip {
+			return true
 		}
 	}
 	return false
 }
+
+func isService(a, b *v1.Service) bool {
+	return a.Namespace == b.Namespace && a.Name == b.Name
+}
+
+// removedIPs returns the IPs of old that are no longer part of cur.
+func removedIPs(old, cur []string) (removed []string) {
+	for _, ip := range old {
+		if !containsIP(cur, ip) {
+			removed = append(removed, ip)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,219 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sapcc/kube-parrot/pkg/types"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	kubeProxyCheckInterval = 5 * time.Second
+	kubeProxyCheckTimeout  = 2 * time.Second
+
+	// kubeProxyTimeLayout is how kube-proxy formats the timestamps of its
+	// healthz response, i.e. time.Time's String().
+	kubeProxyTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+)
+
+// KubeProxyWatchdog checks whether the local kube-proxy keeps programming
+// the dataplane. kube-proxy is considered healthy while its pods on this
+// node are ready and the last sync reported by its /healthz endpoint isn't
+// older than the stale period.
+type KubeProxyWatchdog struct {
+	nodeName   string
+	healthzURL string
+	staleAfter time.Duration
+	onChange   func()
+
+	proxies cache.SharedIndexInformer
+	synced  chan struct{}
+
+	mu      sync.Mutex
+	healthy bool
+}
+
+// kubeProxyHealthz is the response of kube-proxy's /healthz endpoint.
+type kubeProxyHealthz struct {
+	LastUpdated string `json:"lastUpdated"`
+	CurrentTime string `json:"currentTime"`
+}
+
+func NewKubeProxyWatchdog(client kubernetes.Interface, nodeName string, hostIP net.IP, staleAfter time.Duration) *KubeProxyWatchdog {
+	w := &KubeProxyWatchdog{
+		nodeName:   nodeName,
+		healthzURL: fmt.Sprintf("http://%s/healthz", net.JoinHostPort(hostIP.String(), strconv.Itoa(types.KubeProxyHealthzPort))),
+		staleAfter: staleAfter,
+		onChange:   func() {},
+		synced:     make(chan struct{}),
+	}
+
+	// Only the pods on this node are watched, not all pods of the cluster.
+	w.proxies = cache.NewSharedIndexInformer(
+		cache.NewFilteredListWatchFromClient(client.CoreV1().RESTClient(), "pods", types.KubeProxyNamespace,
+			func(options *metav1.ListOptions) {
+				options.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", nodeName).String()
+			}),
+		&v1.Pod{},
+		5*time.Minute,
+		cache.Indexers{},
+	)
+	w.proxies.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { w.check() },
+		UpdateFunc: func(interface{}, interface{}) { w.check() },
+		DeleteFunc: func(interface{}) { w.check() },
+	})
+
+	return w
+}
+
+// OnChange registers a function that is called whenever kube-proxy turns
+// healthy or unhealthy.
+func (w *KubeProxyWatchdog) OnChange(f func()) {
+	w.onChange = f
+}
+
+func (w *KubeProxyWatchdog) Run(stopCh <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	wg.Add(1)
+
+	go w.proxies.Run(stopCh)
+	cache.WaitForCacheSync(stopCh, w.proxies.HasSynced)
+
+	w.check()
+	close(w.synced)
+
+	go wait.Until(w.check, kubeProxyCheckInterval, stopCh)
+
+	<-stopCh
+}
+
+// WaitForSync blocks until the health of kube-proxy was checked once.
+func (w *KubeProxyWatchdog) WaitForSync(stopCh <-chan struct{}) {
+	select {
+	case <-w.synced:
+	case <-stopCh:
+	}
+}
+
+// Healthy returns whether kube-proxy was healthy when last checked.
+func (w *KubeProxyWatchdog) Healthy() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.healthy
+}
+
+func (w *KubeProxyWatchdog) check() {
+	err := w.podsReady()
+	if err == nil {
+		err = w.healthzFresh()
+	}
+
+	w.mu.Lock()
+	changed := w.healthy != (err == nil)
+	w.healthy = err == nil
+	w.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if err != nil {
+		glog.Errorf("kube-proxy on node %s is unhealthy: %s", w.nodeName, err)
+	} else {
+		glog.Infof("kube-proxy on node %s is healthy", w.nodeName)
+	}
+	w.onChange()
+}
+
+func (w *KubeProxyWatchdog) podsReady() error {
+	found := false
+	for _, obj := range w.proxies.GetStore().List() {
+		pod := obj.(*v1.Pod)
+		if !strings.HasPrefix(pod.Name, types.KubeProxyPrefix) || pod.DeletionTimestamp != nil {
+			continue
+		}
+		found = true
+		if !isPodReady(pod) {
+			return fmt.Errorf("pod %s/%s isn't ready", pod.Namespace, pod.Name)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no kube-proxy pod found")
+	}
+	return nil
+}
+
+func (w *KubeProxyWatchdog) healthzFresh() error {
+	client := http.Client{Timeout: kubeProxyCheckTimeout}
+	resp, err := client.Get(w.healthzURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// kube-proxy answers 503 once its own stale detection kicks in.
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("healthz returned %s", resp.Status)
+	}
+
+	healthz := kubeProxyHealthz{}
+	if err := json.NewDecoder(resp.Body).Decode(&healthz); err != nil {
+		return fmt.Errorf("couldn't decode healthz response: %s", err)
+	}
+
+	lastUpdated, err := parseKubeProxyTime(healthz.LastUpdated)
+	if err != nil {
+		return err
+	}
+	currentTime, err := parseKubeProxyTime(healthz.CurrentTime)
+	if err != nil {
+		return err
+	}
+
+	if age := currentTime.Sub(lastUpdated); age > w.staleAfter {
+		return fmt.Errorf("last sync was %s ago", age.Round(time.Second))
+	}
+	return nil
+}
+
+// parseKubeProxyTime parses a timestamp of kube-proxy's healthz response.
+// The monotonic clock reading that time.Time's String() might append is
+// ignored.
+func parseKubeProxyTime(s string) (time.Time, error) {
+	if i := strings.Index(s, " m="); i >= 0 {
+		s = s[:i]
+	}
+	t, err := time.Parse(kubeProxyTimeLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid healthz timestamp %q: %s", s, err)
+	}
+	return t, nil
+}
+
+func isPodReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
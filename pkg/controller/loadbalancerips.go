@@ -0,0 +1,337 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/sapcc/kube-parrot/pkg/forked/informer"
+	"github.com/sapcc/kube-parrot/pkg/ipam"
+	"github.com/sapcc/kube-parrot/pkg/types"
+	reconciler "github.com/sapcc/kube-parrot/pkg/util"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	AnnotationAddressPool = "parrot.sap.cc/address-pool"
+)
+
+// LoadBalancerIPsController assigns addresses from the configured pools to
+// LoadBalancer services of parrot's loadBalancerClass. Only the instance
+// holding the IPAM lease allocates. The allocation state is rebuilt from the
+// services' status on every reconcile, so it survives restarts and addresses
+// of deleted services are free again. Statuses written, but not seen by the
+// informer yet, are taken from the in-flight allocations instead.
+type LoadBalancerIPsController struct {
+	client            kubernetes.Interface
+	pools             []*ipam.Pool
+	loadBalancerClass string
+	reconciler        reconciler.DirtyReconcilerInterface
+	leader            *reconciler.LeaderElector
+
+	services cache.Store
+
+	mu sync.Mutex
+	// inFlight holds the addresses written to the status of services by
+	// their key, until the informer delivers that status.
+	inFlight map[string]inFlightStatus
+}
+
+// inFlightStatus is a status update the informer didn't deliver yet.
+type inFlightStatus struct {
+	resourceVersion string
+	ips             []string
+}
+
+func NewLoadBalancerIPsController(informers informer.SharedInformerFactory, client kubernetes.Interface,
+	nodeName string, loadBalancerClass string, pools []*ipam.Pool) *LoadBalancerIPsController {
+
+	c := &LoadBalancerIPsController{
+		client:            client,
+		pools:             pools,
+		loadBalancerClass: loadBalancerClass,
+		services:          cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc),
+		inFlight:          map[string]inFlightStatus{},
+	}
+
+	c.reconciler = reconciler.NewNamedDirtyReconciler("loadbalancerips", c.reconcile)
+	c.leader = reconciler.NewLeaderElector(client, types.LeaseNamespace, types.IPAMLeaseName, nodeName, c.reconciler.Dirty)
+
+	informers.Services().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.serviceAdd,
+		UpdateFunc: c.serviceUpdate,
+		DeleteFunc: c.serviceDelete,
+	})
+
+	return c
+}
+
+func (c *LoadBalancerIPsController) Run(stopCh <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	wg.Add(1)
+
+	go c.leader.Run(stopCh)
+	c.reconciler.Run(stopCh)
+
+	<-stopCh
+}
+
+func (c *LoadBalancerIPsController) serviceAdd(obj interface{}) {
+	service := obj.(*v1.Service)
+	c.observe(service)
+
+	if !c.isResponsible(service) {
+		if _, exists, _ := c.services.Get(service); exists {
+			glog.V(3).Infof("Deleting LoadBalancer Service (%s/%s)", service.Namespace, service.Name)
+			c.services.Delete(service)
+			c.reconciler.Dirty()
+		}
+		return
+	}
+
+	if _, exists, _ := c.services.Get(service); !exists {
+		glog.V(3).Infof("Adding LoadBalancer Service (%s/%s)", service.Namespace, service.Name)
+		c.services.Add(service)
+	} else {
+		c.services.Update(service)
+	}
+	c.reconciler.Dirty()
+}
+
+func (c *LoadBalancerIPsController) serviceUpdate(old, cur interface{}) {
+	c.serviceAdd(cur)
+}
+
+func (c *LoadBalancerIPsController) serviceDelete(obj interface{}) {
+	service, ok := obj.(*v1.Service)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if service, ok = tombstone.Obj.(*v1.Service); !ok {
+			return
+		}
+	}
+
+	c.mu.Lock()
+	delete(c.inFlight, service.Namespace+"/"+service.Name)
+	c.mu.Unlock()
+
+	if _, exists, _ := c.services.Get(service); exists {
+		glog.V(3).Infof("Deleting LoadBalancer Service (%s/%s). Releasing its addresses", service.Namespace, service.Name)
+		c.services.Delete(service)
+		c.reconciler.Dirty()
+	}
+}
+
+// observe forgets the in-flight status of a service once the informer
+// delivers it, or a status that already has its addresses.
+func (c *LoadBalancerIPsController) observe(svc *v1.Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := svc.Namespace + "/" + svc.Name
+	status, ok := c.inFlight[key]
+	if !ok {
+		return
+	}
+	if svc.ResourceVersion == status.resourceVersion || sameIPs(ingressIPs(svc), status.ips) {
+		delete(c.inFlight, key)
+	}
+}
+
+// currentIPs returns the addresses in the status of a service, or the ones
+// written to it if the informer didn't deliver them yet.
+func (c *LoadBalancerIPsController) currentIPs(svc *v1.Service) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if status, ok := c.inFlight[svc.Namespace+"/"+svc.Name]; ok {
+		return status.ips
+	}
+	return ingressIPs(svc)
+}
+
+func (c *LoadBalancerIPsController) isResponsible(svc *v1.Service) bool {
+	return svc.Spec.Type == v1.ServiceTypeLoadBalancer &&
+		svc.Spec.LoadBalancerClass != nil && *svc.Spec.LoadBalancerClass == c.loadBalancerClass
+}
+
+func (c *LoadBalancerIPsController) reconcile() error {
+	if !c.leader.IsLeader() {
+		return nil
+	}
+	return c.assign()
+}
+
+// assign allocates addresses for all services that lack one and drops
+// addresses assigned more than once.
+func (c *LoadBalancerIPsController) assign() error {
+	// Oldest services come first, so they keep their addresses if the
+	// same address was assigned more than once.
+	var services []*v1.Service
+	for _, obj := range c.services.List() {
+		services = append(services, obj.(*v1.Service))
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if !services[i].CreationTimestamp.Equal(&services[j].CreationTimestamp) {
+			return services[i].CreationTimestamp.Before(&services[j].CreationTimestamp)
+		}
+		return services[i].Namespace+"/"+services[i].Name < services[j].Namespace+"/"+services[j].Name
+	})
+
+	allocator := ipam.NewAllocator(c.pools)
+	current := make(map[*v1.Service][]string)
+	assigned := make(map[*v1.Service][]netip.Addr)
+	for _, svc := range services {
+		owner := svc.Namespace + "/" + svc.Name
+		current[svc] = c.currentIPs(svc)
+		for _, s := range current[svc] {
+			ip, err := netip.ParseAddr(s)
+			if err != nil {
+				continue
+			}
+			if err := allocator.Assign(owner, svc.Namespace, ip); err != nil {
+				if errors.Is(err, ipam.ErrNotInPool) {
+					glog.Warningf("LoadBalancer IP %s of service %s is not part of any pool. Leaving it alone", ip, owner)
+					assigned[svc] = append(assigned[svc], ip)
+				} else {
+					glog.Errorf("Dropping LoadBalancer IP %s of service %s: %s", ip, owner, err)
+				}
+				continue
+			}
+			assigned[svc] = append(assigned[svc], ip)
+		}
+	}
+
+	var lastErr error
+	for _, svc := range services {
+		ips, changed, err := c.allocate(allocator, svc, current[svc], assigned[svc])
+		if err != nil {
+			glog.Errorf("Couldn't allocate LoadBalancer IP for service %s/%s: %s", svc.Namespace, svc.Name, err)
+			lastErr = err
+		}
+		if !changed {
+			continue
+		}
+
+		if err := c.updateStatus(svc, ips); err != nil {
+			glog.Errorf("Couldn't update status of service %s/%s: %s", svc.Namespace, svc.Name, err)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// allocate returns the addresses the service should have, one per requested
+// IP family, and whether these differ from its current ones.
+func (c *LoadBalancerIPsController) allocate(allocator *ipam.Allocator, svc *v1.Service, current []string, assigned []netip.Addr) ([]netip.Addr, bool, error) {
+	owner := svc.Namespace + "/" + svc.Name
+
+	changed := len(assigned) != len(current)
+	for i := 0; !changed && i < len(assigned); i++ {
+		changed = assigned[i].String() != current[i]
+	}
+
+	families := svc.Spec.IPFamilies
+	if len(families) == 0 {
+		families = []v1.IPFamily{v1.IPv4Protocol}
+	}
+
+	ips := assigned
+	for _, family := range families {
+		ipv6 := family == v1.IPv6Protocol
+		if hasFamily(ips, ipv6) {
+			continue
+		}
+
+		ip, err := allocator.Allocate(owner, svc.Namespace, svc.Annotations[AnnotationAddressPool], ipv6)
+		if err != nil {
+			return ips, changed, err
+		}
+		glog.Infof("Allocated LoadBalancer IP %s for service %s", ip, owner)
+		ips = append(ips, ip)
+		changed = true
+	}
+
+	return ips, changed, nil
+}
+
+func (c *LoadBalancerIPsController) updateStatus(svc *v1.Service, ips []netip.Addr) error {
+	updated := svc.DeepCopy()
+	updated.Status.LoadBalancer.Ingress = nil
+
+	// Entries without an IP are kept, as are the other fields of entries
+	// whose IP stays.
+	existing := map[string]v1.LoadBalancerIngress{}
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP == "" {
+			updated.Status.LoadBalancer.Ingress = append(updated.Status.LoadBalancer.Ingress, ingress)
+			continue
+		}
+		existing[ingress.IP] = ingress
+	}
+	for _, ip := range ips {
+		ingress, ok := existing[ip.String()]
+		if !ok {
+			ingress = v1.LoadBalancerIngress{IP: ip.String()}
+		}
+		updated.Status.LoadBalancer.Ingress = append(updated.Status.LoadBalancer.Ingress, ingress)
+	}
+
+	result, err := c.client.CoreV1().Services(svc.Namespace).UpdateStatus(context.Background(), updated, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	// Until the informer catches up, the next reconcile must not hand out
+	// these addresses again.
+	c.mu.Lock()
+	c.inFlight[svc.Namespace+"/"+svc.Name] = inFlightStatus{resourceVersion: result.ResourceVersion, ips: ingressIPs(result)}
+	c.mu.Unlock()
+	return nil
+}
+
+// ingressIPs returns the addresses in the status of a service. Ingress
+// entries without an IP, e.g. with a hostname only, aren't ours.
+func ingressIPs(svc *v1.Service) (ips []string) {
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			ips = append(ips, ingress.IP)
+		}
+	}
+	return ips
+}
+
+func sameIPs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func hasFamily(ips []netip.Addr, ipv6 bool) bool {
+	for _, ip := range ips {
+		if ip.Unmap().Is6() == ipv6 {
+			return true
+		}
+	}
+	return false
+}
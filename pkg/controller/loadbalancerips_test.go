@@ -0,0 +1,105 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sapcc/kube-parrot/pkg/ipam"
+	reconciler "github.com/sapcc/kube-parrot/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testLoadBalancerClass = "parrot"
+
+func loadBalancerService(name string, created time.Time) *v1.Service {
+	class := testLoadBalancerClass
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, CreationTimestamp: metav1.NewTime(created)},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer, LoadBalancerClass: &class},
+	}
+}
+
+func statusIPs(t *testing.T, c *LoadBalancerIPsController, name string) []string {
+	t.Helper()
+	svc, err := c.client.CoreV1().Services("default").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ingressIPs(svc)
+}
+
+func TestLoadBalancerIPsRemembersInFlightStatus(t *testing.T) {
+	pool, err := ipam.NewPool("a", []string{"10.0.0.0/29"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	older, newer := loadBalancerService("a", time.Unix(100, 0)), loadBalancerService("b", time.Unix(200, 0))
+	c := &LoadBalancerIPsController{
+		client:            fake.NewSimpleClientset(older, newer),
+		pools:             []*ipam.Pool{pool},
+		loadBalancerClass: testLoadBalancerClass,
+		services:          cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc),
+		inFlight:          map[string]inFlightStatus{},
+	}
+	// Nothing is reconciled in the background, the test assigns itself.
+	c.reconciler = reconciler.NewNamedDirtyReconciler("test", c.assign)
+
+	c.services.Add(newer)
+	if err := c.assign(); err != nil {
+		t.Fatal(err)
+	}
+	if ips := statusIPs(t, c, "b"); !reflect.DeepEqual(ips, []string{"10.0.0.1"}) {
+		t.Fatalf("expected 10.0.0.1 for service b, got %v", ips)
+	}
+
+	// The informer hasn't delivered the status of b yet, when the older
+	// service a becomes eligible.
+	c.services.Add(older)
+	if err := c.assign(); err != nil {
+		t.Fatal(err)
+	}
+	if ips := statusIPs(t, c, "a"); !reflect.DeepEqual(ips, []string{"10.0.0.2"}) {
+		t.Errorf("expected 10.0.0.2 for service a, got %v", ips)
+	}
+	if ips := statusIPs(t, c, "b"); !reflect.DeepEqual(ips, []string{"10.0.0.1"}) {
+		t.Errorf("expected service b to keep 10.0.0.1, got %v", ips)
+	}
+
+	// Once the informer delivers the statuses, they aren't in flight anymore.
+	for _, name := range []string{"a", "b"} {
+		svc, err := c.client.CoreV1().Services("default").Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.serviceUpdate(nil, svc)
+	}
+	if len(c.inFlight) != 0 {
+		t.Errorf("expected no in-flight statuses, got %v", c.inFlight)
+	}
+
+	// A deleted service releases its address.
+	c.serviceDelete(newer)
+	if err := c.assign(); err != nil {
+		t.Fatal(err)
+	}
+	third := loadBalancerService("c", time.Unix(300, 0))
+	if _, err := c.client.CoreV1().Services("default").Create(context.Background(), third, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	c.services.Add(third)
+	if err := c.assign(); err != nil {
+		t.Fatal(err)
+	}
+	if ips := statusIPs(t, c, "c"); !reflect.DeepEqual(ips, []string{"10.0.0.1"}) {
+		t.Errorf("expected service c to get the released 10.0.0.1, got %v", ips)
+	}
+}
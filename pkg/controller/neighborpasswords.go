@@ -0,0 +1,181 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/sapcc/kube-parrot/pkg/bgp"
+	reconciler "github.com/sapcc/kube-parrot/pkg/util"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// passwordFileInterval is how often password files are re-read. Mounted
+// Secret volumes are updated by swapping symlinks, which is easier to catch
+// by polling than by watching the files.
+const passwordFileInterval = 30 * time.Second
+
+// NeighborPasswordsController keeps the TCP MD5 passwords of the BGP
+// neighbors in sync with the Secrets and files they are read from. Only the
+// referenced Secrets are watched. Once a password rotates, the sessions of
+// the affected neighbors are reset.
+type NeighborPasswordsController struct {
+	server     *bgp.Server
+	neighbors  []reconciler.Neighbor
+	reconciler reconciler.DirtyReconcilerInterface
+	synced     chan struct{}
+
+	secrets map[string]cache.SharedIndexInformer
+}
+
+func NewNeighborPasswordsController(client kubernetes.Interface, server *bgp.Server,
+	neighbors []reconciler.Neighbor) *NeighborPasswordsController {
+
+	c := &NeighborPasswordsController{
+		server:  server,
+		synced:  make(chan struct{}),
+		secrets: map[string]cache.SharedIndexInformer{},
+	}
+
+	c.reconciler = reconciler.NewNamedDirtyReconciler("neighborpasswords", c.reconcile)
+
+	for _, neighbor := range neighbors {
+		if neighbor.Password == nil {
+			continue
+		}
+		c.neighbors = append(c.neighbors, neighbor)
+
+		p := neighbor.Password
+		if p.SecretName == "" {
+			continue
+		}
+		key := p.GetSecretNamespace() + "/" + p.SecretName
+		if _, exists := c.secrets[key]; exists {
+			continue
+		}
+
+		informer := cache.NewSharedIndexInformer(
+			cache.NewListWatchFromClient(client.CoreV1().RESTClient(), "secrets", p.GetSecretNamespace(),
+				fields.OneTermEqualSelector("metadata.name", p.SecretName)),
+			&v1.Secret{},
+			5*time.Minute,
+			cache.Indexers{},
+		)
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.secretAdd,
+			UpdateFunc: c.secretUpdate,
+			DeleteFunc: c.secretDelete,
+		})
+		c.secrets[key] = informer
+	}
+
+	return c
+}
+
+// HasNeighbors returns whether any neighbor is configured with a password.
+func (c *NeighborPasswordsController) HasNeighbors() bool {
+	return len(c.neighbors) > 0
+}
+
+func (c *NeighborPasswordsController) Run(stopCh <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	wg.Add(1)
+
+	var hasSynced []cache.InformerSynced
+	for _, informer := range c.secrets {
+		go informer.Run(stopCh)
+		hasSynced = append(hasSynced, informer.HasSynced)
+	}
+	cache.WaitForCacheSync(stopCh, hasSynced...)
+
+	if err := c.reconcile(); err != nil {
+		glog.Errorf("Couldn't set initial neighbor passwords: %s", err)
+		c.reconciler.Dirty()
+	}
+	close(c.synced)
+
+	go wait.Until(c.reconciler.Dirty, passwordFileInterval, stopCh)
+	c.reconciler.Run(stopCh)
+
+	<-stopCh
+}
+
+// WaitForSync blocks until the initial passwords have been read, so the
+// neighbors can be added with them right away.
+func (c *NeighborPasswordsController) WaitForSync(stopCh <-chan struct{}) {
+	select {
+	case <-c.synced:
+	case <-stopCh:
+	}
+}
+
+func (c *NeighborPasswordsController) secretAdd(obj interface{}) {
+	secret := obj.(*v1.Secret)
+	glog.V(3).Infof("Adding Secret (%s/%s)", secret.Namespace, secret.Name)
+	c.reconciler.Dirty()
+}
+
+func (c *NeighborPasswordsController) secretUpdate(old, cur interface{}) {
+	c.reconciler.Dirty()
+}
+
+func (c *NeighborPasswordsController) secretDelete(obj interface{}) {
+	c.reconciler.Dirty()
+}
+
+func (c *NeighborPasswordsController) reconcile() error {
+	var failed []string
+	for _, neighbor := range c.neighbors {
+		password, err := c.password(neighbor.Password)
+		if err != nil {
+			glog.Errorf("Couldn't read password of neighbor %s: %s", neighbor.Address, err)
+			failed = append(failed, neighbor.Address)
+			continue
+		}
+		if err := c.server.SetNeighborPassword(neighbor.Address, password); err != nil {
+			glog.Errorf("Oops. Something went wrong updating the password of neighbor %s: %s", neighbor.Address, err)
+			failed = append(failed, neighbor.Address)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("couldn't update passwords of neighbors %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (c *NeighborPasswordsController) password(p *reconciler.NeighborPassword) (string, error) {
+	if p.File != "" {
+		password, err := ioutil.ReadFile(p.File)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(password)), nil
+	}
+
+	key := p.GetSecretNamespace() + "/" + p.SecretName
+	obj, exists, err := c.secrets[key].GetStore().GetByKey(key)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("secret %s not found", key)
+	}
+
+	password, ok := obj.(*v1.Secret).Data[p.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", key, p.Key)
+	}
+	return string(password), nil
+}
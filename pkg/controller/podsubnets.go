@@ -55,19 +55,19 @@ func (c *PodSubnetsController) Run(stopCh <-chan struct{}, wg *sync.WaitGroup) {
 	<-stopCh
 }
 
+// Reconciled is closed once all routes have been announced for the first time.
+func (c *PodSubnetsController) Reconciled() <-chan struct{} {
+	return c.reconciler.Reconciled()
+}
+
 func (c *PodSubnetsController) nodeAdd(obj interface{}) {
 	node := obj.(*v1.Node)
 
-	ip, err := util.GetNodeInternalIP(node)
-	if err != nil {
-		glog.Errorf("Node (%s) doesn't have an internal ip. Skipping.", node.Name)
-	}
-
-	if ip != c.hostIP.String() {
+	if !c.isLocal(node) {
 		return
 	}
 
-	if _, err := util.GetNodePodSubnet(node); err != nil {
+	if _, err := util.GetNodePodSubnets(node); err != nil {
 		if _, exists, _ := c.nodes.Get(node); exists {
 			glog.V(3).Infof("Deleting Node (%s)", node.Name)
 			c.nodes.Delete(node)
@@ -76,11 +76,17 @@ func (c *PodSubnetsController) nodeAdd(obj interface{}) {
 		return
 	}
 
+	if _, err := bgp.NodeAttributes(node); err != nil {
+		glog.Errorf("Ignoring invalid path attribute annotations of node %s: %s", node.Name, err)
+	}
+
 	if _, exists, _ := c.nodes.Get(node); !exists {
 		glog.V(3).Infof("Adding Node (%s)", node.Name)
 		c.nodes.Add(node)
-		c.reconciler.Dirty()
+	} else {
+		c.nodes.Update(node) // pod CIDRs might have changed
 	}
+	c.reconciler.Dirty()
 }
 
 func (c *PodSubnetsController) nodeUpdate(old, cur interface{}) {
@@ -97,18 +103,67 @@ func (c *PodSubnetsController) nodeDelete(obj interface{}) {
 
 func (c *PodSubnetsController) reconcile() error {
 	for _, route := range c.routes.List() {
-		if _, ok, _ := c.nodes.Get(route.Node); !ok {
+		obj, ok, _ := c.nodes.Get(route.Node)
+		if !ok || !hasPodSubnet(obj.(*v1.Node), route.Subnet) || !sameNextHop(obj.(*v1.Node), route) {
 			if err := c.routes.Delete(route); err != nil {
 				return err
 			}
 		}
 	}
 
-	for _, node := range c.nodes.List() {
-		if err := c.routes.Add(node.(*v1.Node)); err != nil {
-			return err
+	for _, obj := range c.nodes.List() {
+		node := obj.(*v1.Node)
+		subnets, err := util.GetNodePodSubnets(node)
+		if err != nil {
+			continue
+		}
+		for _, subnet := range subnets {
+			if _, _, err := net.ParseCIDR(subnet); err != nil {
+				glog.Errorf("Skipping pod subnet of node %s: %s", node.Name, err)
+				continue
+			}
+			if route := bgp.NewNodePodSubnetRoute(node, subnet); route.NextHop() == nil {
+				glog.Errorf("Skipping pod subnet %s of node %s. No InternalIP of the same address family", subnet, node.Name)
+				continue
+			}
+			if err := c.routes.Add(node, subnet); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
+
+// isLocal checks whether the node is the one parrot runs on, i.e. whether
+// any of its InternalIPs is the host IP. On dual-stack nodes, the host IP
+// isn't necessarily listed first.
+func (c *PodSubnetsController) isLocal(node *v1.Node) bool {
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeInternalIP && c.hostIP.Equal(net.ParseIP(address.Address)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPodSubnet(node *v1.Node, subnet string) bool {
+	subnets, err := util.GetNodePodSubnets(node)
+	if err != nil {
+		return false
+	}
+	for _, s := range subnets {
+		if s == subnet {
+			return true
+		}
+	}
+	return false
+}
+
+// sameNextHop checks whether the route still has the InternalIP of the node
+// as next hop. The InternalIPs of a node might change, or be gone for the
+// address family of the subnet.
+func sameNextHop(node *v1.Node, route bgp.NodePodSubnetRoute) bool {
+	current, announced := bgp.NewNodePodSubnetRoute(node, route.Subnet).NextHop(), route.NextHop()
+	return current != nil && announced != nil && current.Equal(*announced)
+}
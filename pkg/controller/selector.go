@@ -0,0 +1,96 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/golang/glog"
+	"github.com/sapcc/kube-parrot/pkg/forked/informer"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	AnnotationAnnounce = "parrot.sap.cc/announce"
+)
+
+// ServiceSelector decides which services are announced at all.
+type ServiceSelector struct {
+	// Namespaces selects the namespaces by their labels. All namespaces are
+	// selected if nil.
+	Namespaces labels.Selector
+	// Services selects services by their labels. All services are selected
+	// if nil.
+	Services labels.Selector
+	// OptIn only announces services annotated with parrot.sap.cc/announce=true.
+	// Otherwise, services opt out with parrot.sap.cc/announce=false.
+	OptIn bool
+}
+
+// NewServiceSelector parses the given label selectors. Empty selectors
+// select everything.
+func NewServiceSelector(namespaceSelector, serviceSelector string, optIn bool) (ServiceSelector, error) {
+	s := ServiceSelector{OptIn: optIn}
+
+	if namespaceSelector != "" {
+		selector, err := labels.Parse(namespaceSelector)
+		if err != nil {
+			return s, fmt.Errorf("invalid namespace selector %q: %s", namespaceSelector, err)
+		}
+		s.Namespaces = selector
+	}
+
+	if serviceSelector != "" {
+		selector, err := labels.Parse(serviceSelector)
+		if err != nil {
+			return s, fmt.Errorf("invalid service selector %q: %s", serviceSelector, err)
+		}
+		s.Services = selector
+	}
+
+	return s, nil
+}
+
+// Matches checks whether the service is selected. namespaces is only used
+// with a namespace selector.
+func (s ServiceSelector) Matches(svc *v1.Service, namespaces *informer.StoreToNamespaceLister) bool {
+	if !s.announced(svc) {
+		return false
+	}
+
+	if s.Services != nil && !s.Services.Matches(labels.Set(svc.Labels)) {
+		return false
+	}
+
+	if s.Namespaces != nil {
+		ns, err := namespaces.Get(svc.Namespace)
+		if err != nil {
+			glog.V(3).Infof("Couldn't get namespace of service %s/%s: %s", svc.Namespace, svc.Name, err)
+			return false
+		}
+		if !s.Namespaces.Matches(labels.Set(ns.Labels)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// announced evaluates the opt-in or opt-out annotation of the service.
+func (s ServiceSelector) announced(svc *v1.Service) bool {
+	value, ok := svc.Annotations[AnnotationAnnounce]
+	if !ok {
+		return !s.OptIn
+	}
+
+	announce, err := strconv.ParseBool(value)
+	if err != nil {
+		glog.Errorf("Ignoring %s of service %s/%s: %s", AnnotationAnnounce, svc.Namespace, svc.Name, err)
+		return !s.OptIn
+	}
+	return announce
+}
@@ -4,10 +4,15 @@
 package informer
 
 import (
+	"context"
 	"reflect"
 	"time"
 
 	"k8s.io/api/core/v1"
+	discovery_v1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	informers_v1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
@@ -56,41 +61,54 @@ func NewPodInformer(client kubernetes.Interface, resyncPeriod time.Duration) cac
 	)
 }
 
-type EndpointInformer interface {
+type EndpointSliceInformer interface {
 	Informer() cache.SharedIndexInformer
-	Lister() *StoreToEndpointsLister
+	Lister() *StoreToEndpointSliceLister
 }
 
-type endpointInformer struct {
+type endpointSliceInformer struct {
 	*sharedInformerFactory
 }
 
-func (f *endpointInformer) Informer() cache.SharedIndexInformer {
+// Informer checks whether endpointSliceInformer exists in sharedInformerFactory and if not, it creates new informer of type
+// endpointSliceInformer and connects it to sharedInformerFactory
+func (f *endpointSliceInformer) Informer() cache.SharedIndexInformer {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
-	informerType := reflect.TypeOf(&v1.Endpoints{})
+	informerType := reflect.TypeOf(&discovery_v1.EndpointSlice{})
 	informer, exists := f.informers[informerType]
 	if exists {
 		return informer
 	}
-	informer = NewEndpointInformer(f.client, f.defaultResync)
+	informer = NewEndpointSliceInformer(f.client, f.defaultResync)
 	f.informers[informerType] = informer
 
 	return informer
 }
 
-func (f *endpointInformer) Lister() *StoreToEndpointsLister {
+// Lister returns lister for endpointSliceInformer
+func (f *endpointSliceInformer) Lister() *StoreToEndpointSliceLister {
 	informer := f.Informer()
-	return &StoreToEndpointsLister{Store: informer.GetStore()}
-}
-
-func NewEndpointInformer(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
-	return informers_v1.NewEndpointsInformer(
-		client,
-		"",
+	return &StoreToEndpointSliceLister{Indexer: informer.GetIndexer()}
+}
+
+func NewEndpointSliceInformer(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.DiscoveryV1().EndpointSlices(metav1.NamespaceAll).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.DiscoveryV1().EndpointSlices(metav1.NamespaceAll).Watch(context.TODO(), options)
+			},
+		},
+		&discovery_v1.EndpointSlice{},
 		resyncPeriod,
-		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		cache.Indexers{
+			cache.NamespaceIndex:      cache.MetaNamespaceIndexFunc,
+			EndpointSliceServiceIndex: EndpointSliceServiceIndexFunc,
+		},
 	)
 }
 
@@ -171,3 +189,43 @@ func NewNodeInformer(client kubernetes.Interface, resyncPeriod time.Duration) ca
 		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
 	)
 }
+
+type NamespaceInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() *StoreToNamespaceLister
+}
+
+type namespaceInformer struct {
+	*sharedInformerFactory
+}
+
+// Informer checks whether namespaceInformer exists in sharedInformerFactory and if not, it creates new informer of type
+// namespaceInformer and connects it to sharedInformerFactory
+func (f *namespaceInformer) Informer() cache.SharedIndexInformer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	informerType := reflect.TypeOf(&v1.Namespace{})
+	informer, exists := f.informers[informerType]
+	if exists {
+		return informer
+	}
+	informer = NewNamespaceInformer(f.client, f.defaultResync)
+	f.informers[informerType] = informer
+
+	return informer
+}
+
+// Lister returns lister for namespaceInformer
+func (f *namespaceInformer) Lister() *StoreToNamespaceLister {
+	informer := f.Informer()
+	return &StoreToNamespaceLister{Store: informer.GetStore()}
+}
+
+func NewNamespaceInformer(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return informers_v1.NewNamespaceInformer(
+		client,
+		resyncPeriod,
+		cache.Indexers{},
+	)
+}
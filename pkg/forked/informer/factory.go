@@ -17,8 +17,9 @@ type SharedInformerFactory interface {
 
 	Services() ServiceInformer
 	Nodes() NodeInformer
-	Endpoints() EndpointInformer
+	EndpointSlices() EndpointSliceInformer
 	Pods() PodInformer
+	Namespaces() NamespaceInformer
 }
 
 type sharedInformerFactory struct {
@@ -63,6 +64,10 @@ func (s *sharedInformerFactory) Nodes() NodeInformer {
 	return &nodeInformer{sharedInformerFactory: s}
 }
 
-func (s *sharedInformerFactory) Endpoints() EndpointInformer {
-	return &endpointInformer{sharedInformerFactory: s}
+func (s *sharedInformerFactory) EndpointSlices() EndpointSliceInformer {
+	return &endpointSliceInformer{sharedInformerFactory: s}
+}
+
+func (s *sharedInformerFactory) Namespaces() NamespaceInformer {
+	return &namespaceInformer{sharedInformerFactory: s}
 }
@@ -10,6 +10,7 @@ import (
 	"k8s.io/client-go/tools/cache"
 
 	v1 "k8s.io/api/core/v1"
+	discovery_v1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -94,29 +95,45 @@ func (s storeToNodeConditionLister) List() (nodes []*v1.Node, err error) {
 	return
 }
 
-// StoreToEndpointsLister makes a Store that lists endpoints.
-type StoreToEndpointsLister struct {
-	cache.Store
+// EndpointSliceServiceIndex indexes EndpointSlices by the namespace/name of the service they belong to.
+const EndpointSliceServiceIndex = "service"
+
+// EndpointSliceServiceIndexFunc returns the namespace/name key of the service owning an EndpointSlice.
+func EndpointSliceServiceIndexFunc(obj interface{}) ([]string, error) {
+	slice, ok := obj.(*discovery_v1.EndpointSlice)
+	if !ok {
+		return nil, fmt.Errorf("object is not an EndpointSlice: %T", obj)
+	}
+	name, ok := slice.Labels[discovery_v1.LabelServiceName]
+	if !ok || name == "" {
+		return nil, nil
+	}
+	return []string{slice.Namespace + "/" + name}, nil
 }
 
-// List lists all endpoints in the store.
-func (s *StoreToEndpointsLister) List() (services v1.EndpointsList, err error) {
-	for _, m := range s.Store.List() {
-		services.Items = append(services.Items, *(m.(*v1.Endpoints)))
+// StoreToEndpointSliceLister makes an Indexer that lists EndpointSlices.
+type StoreToEndpointSliceLister struct {
+	Indexer cache.Indexer
+}
+
+// List lists all EndpointSlices in the indexer.
+func (s *StoreToEndpointSliceLister) List() (ret []*discovery_v1.EndpointSlice, err error) {
+	for _, m := range s.Indexer.List() {
+		ret = append(ret, m.(*discovery_v1.EndpointSlice))
 	}
-	return services, nil
+	return ret, nil
 }
 
-// GetServiceEndpoints returns the endpoints of a service, matched on service name.
-func (s *StoreToEndpointsLister) GetServiceEndpoints(svc *v1.Service) (ep v1.Endpoints, err error) {
-	for _, m := range s.Store.List() {
-		ep = *m.(*v1.Endpoints)
-		if svc.Name == ep.Name && svc.Namespace == ep.Namespace {
-			return ep, nil
-		}
+// GetServiceEndpointSlices returns all EndpointSlices belonging to a service.
+func (s *StoreToEndpointSliceLister) GetServiceEndpointSlices(svc *v1.Service) (ret []*discovery_v1.EndpointSlice, err error) {
+	objs, err := s.Indexer.ByIndex(EndpointSliceServiceIndex, svc.Namespace+"/"+svc.Name)
+	if err != nil {
+		return nil, err
 	}
-	err = fmt.Errorf("could not find endpoints for service: %v", svc.Name)
-	return
+	for _, m := range objs {
+		ret = append(ret, m.(*discovery_v1.EndpointSlice))
+	}
+	return ret, nil
 }
 
 type StoreToPodLister struct {
@@ -156,3 +173,20 @@ func (s storePodsNamespacer) Get(name string) (*v1.Pod, error) {
 	}
 	return obj.(*v1.Pod), nil
 }
+
+// StoreToNamespaceLister makes a Store have the Get method of the client.NamespaceInterface
+// The Store must contain (only) Namespaces.
+type StoreToNamespaceLister struct {
+	cache.Store
+}
+
+func (s *StoreToNamespaceLister) Get(name string) (*v1.Namespace, error) {
+	obj, exists, err := s.Store.GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(schema.ParseGroupResource("namespace"), name)
+	}
+	return obj.(*v1.Namespace), nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package healthcheck
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	AnnotationHealthCheck         = "parrot.sap.cc/health-check"
+	AnnotationHealthCheckPort     = "parrot.sap.cc/health-check-port"
+	AnnotationHealthCheckPath     = "parrot.sap.cc/health-check-path"
+	AnnotationHealthCheckInterval = "parrot.sap.cc/health-check-interval"
+	AnnotationHealthCheckTimeout  = "parrot.sap.cc/health-check-timeout"
+	AnnotationHealthCheckRise     = "parrot.sap.cc/health-check-rise"
+	AnnotationHealthCheckFall     = "parrot.sap.cc/health-check-fall"
+
+	// TypeTCP connects to the service IP on this node.
+	TypeTCP = "tcp"
+	// TypeHTTP sends a GET request to the service IP on this node. Status
+	// codes from 200 to 399 count as success.
+	TypeHTTP = "http"
+	// TypeKubeProxy probes the healthz endpoint of the local kube-proxy.
+	TypeKubeProxy = "kube-proxy"
+
+	defaultInterval = 5 * time.Second
+	defaultTimeout  = 1 * time.Second
+	defaultRise     = 2
+	defaultFall     = 3
+)
+
+// Check configures an active health check gating the announcement of a
+// service's IPs.
+type Check struct {
+	Type     string
+	Port     int
+	Path     string
+	Interval time.Duration
+	Timeout  time.Duration
+	// Rise is the number of consecutive successes after which a failing
+	// check passes again, Fall the number of consecutive failures after
+	// which a passing check fails.
+	Rise int
+	Fall int
+}
+
+// ServiceCheck returns the health check configured by the annotations of a
+// service, or nil if it has none. The port defaults to the service's first
+// port.
+func ServiceCheck(svc *v1.Service) (*Check, error) {
+	annotations := svc.Annotations
+	t, ok := annotations[AnnotationHealthCheck]
+	if !ok {
+		return nil, nil
+	}
+
+	check := &Check{
+		Type:     t,
+		Path:     "/",
+		Interval: defaultInterval,
+		Timeout:  defaultTimeout,
+		Rise:     defaultRise,
+		Fall:     defaultFall,
+	}
+	if len(svc.Spec.Ports) > 0 {
+		check.Port = int(svc.Spec.Ports[0].Port)
+	}
+
+	switch t {
+	case TypeTCP, TypeHTTP, TypeKubeProxy:
+	default:
+		return nil, fmt.Errorf("invalid %s %q: must be one of %s, %s or %s", AnnotationHealthCheck, t, TypeTCP, TypeHTTP, TypeKubeProxy)
+	}
+
+	var err error
+	if v, ok := annotations[AnnotationHealthCheckPort]; ok {
+		if check.Port, err = strconv.Atoi(v); err != nil || check.Port < 1 || check.Port > 65535 {
+			return nil, fmt.Errorf("invalid %s %q", AnnotationHealthCheckPort, v)
+		}
+	}
+	if v, ok := annotations[AnnotationHealthCheckPath]; ok {
+		check.Path = v
+	}
+	if v, ok := annotations[AnnotationHealthCheckInterval]; ok {
+		if check.Interval, err = time.ParseDuration(v); err != nil || check.Interval <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", AnnotationHealthCheckInterval, v)
+		}
+	}
+	if v, ok := annotations[AnnotationHealthCheckTimeout]; ok {
+		if check.Timeout, err = time.ParseDuration(v); err != nil || check.Timeout <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", AnnotationHealthCheckTimeout, v)
+		}
+	}
+	if v, ok := annotations[AnnotationHealthCheckRise]; ok {
+		if check.Rise, err = strconv.Atoi(v); err != nil || check.Rise < 1 {
+			return nil, fmt.Errorf("invalid %s %q", AnnotationHealthCheckRise, v)
+		}
+	}
+	if v, ok := annotations[AnnotationHealthCheckFall]; ok {
+		if check.Fall, err = strconv.Atoi(v); err != nil || check.Fall < 1 {
+			return nil, fmt.Errorf("invalid %s %q", AnnotationHealthCheckFall, v)
+		}
+	}
+
+	if check.Type != TypeKubeProxy && check.Port == 0 {
+		return nil, fmt.Errorf("%s is required for services without ports", AnnotationHealthCheckPort)
+	}
+
+	return check, nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package healthcheck
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Checker runs health checks in the background. Each check starts out
+// failing and needs to succeed Rise times before it passes.
+type Checker struct {
+	hostIP        net.IP
+	kubeProxyPort int
+	onChange      func()
+
+	mu     sync.Mutex
+	probes map[string]*probe
+}
+
+type probe struct {
+	check   Check
+	target  string
+	healthy bool
+	stop    chan struct{}
+}
+
+// NewChecker returns a checker. kube-proxy checks probe hostIP on
+// kubeProxyPort. onChange is called whenever a check starts passing or
+// failing.
+func NewChecker(hostIP net.IP, kubeProxyPort int, onChange func()) *Checker {
+	return &Checker{
+		hostIP:        hostIP,
+		kubeProxyPort: kubeProxyPort,
+		onChange:      onChange,
+		probes:        map[string]*probe{},
+	}
+}
+
+// Healthy returns whether the check of ip passes. It starts the check,
+// or restarts it if its configuration changed. key identifies the check.
+func (c *Checker) Healthy(key, ip string, check Check) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if p, ok := c.probes[key]; ok {
+		if p.check == check && p.target == ip {
+			return p.healthy
+		}
+		close(p.stop)
+	}
+
+	p := &probe{check: check, target: ip, stop: make(chan struct{})}
+	c.probes[key] = p
+	go c.run(key, p)
+
+	return false
+}
+
+// Retain stops all checks except the given ones.
+func (c *Checker) Retain(keys map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, p := range c.probes {
+		if !keys[key] {
+			glog.V(3).Infof("Stopping health check %s", key)
+			close(p.stop)
+			delete(c.probes, key)
+		}
+	}
+}
+
+// Stop stops all checks.
+func (c *Checker) Stop() {
+	c.Retain(nil)
+}
+
+// Passing is a checker whose checks always pass without probing anything,
+// e.g. to plan routes away from the cluster.
+type Passing struct{}
+
+func (Passing) Healthy(key, ip string, check Check) bool { return true }
+func (Passing) Retain(keys map[string]bool)              {}
+func (Passing) Stop()                                    {}
+
+func (c *Checker) run(key string, p *probe) {
+	glog.V(3).Infof("Starting %s health check %s", p.check.Type, key)
+
+	ticker := time.NewTicker(p.check.Interval)
+	defer ticker.Stop()
+
+	successes, failures := 0, 0
+	for {
+		err := c.probe(p)
+		if err == nil {
+			successes, failures = successes+1, 0
+		} else {
+			glog.V(5).Infof("Health check %s failed: %s", key, err)
+			successes, failures = 0, failures+1
+		}
+
+		c.mu.Lock()
+		changed := false
+		select {
+		case <-p.stop:
+			c.mu.Unlock()
+			return
+		default:
+		}
+		if !p.healthy && successes >= p.check.Rise {
+			glog.Infof("Health check %s passed", key)
+			p.healthy, changed = true, true
+		} else if p.healthy && failures >= p.check.Fall {
+			glog.Infof("Health check %s failed: %s", key, err)
+			p.healthy, changed = false, true
+		}
+		c.mu.Unlock()
+
+		if changed {
+			c.onChange()
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Checker) probe(p *probe) error {
+	switch p.check.Type {
+	case TypeTCP:
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(p.target, strconv.Itoa(p.check.Port)), p.check.Timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case TypeHTTP:
+		return httpGet(fmt.Sprintf("http://%s%s", net.JoinHostPort(p.target, strconv.Itoa(p.check.Port)), p.check.Path), p.check.Timeout)
+	case TypeKubeProxy:
+		return httpGet(fmt.Sprintf("http://%s/healthz", net.JoinHostPort(c.hostIP.String(), strconv.Itoa(c.kubeProxyPort))), p.check.Timeout)
+	}
+	return fmt.Errorf("unknown health check type %q", p.check.Type)
+}
+
+func httpGet(url string, timeout time.Duration) error {
+	client := http.Client{
+		Timeout: timeout,
+		// Redirects count as success, like for kubelet's HTTP probes.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
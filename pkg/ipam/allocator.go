@@ -0,0 +1,95 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package ipam
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+var (
+	// ErrConflict is returned when an address is already owned by someone else.
+	ErrConflict = errors.New("address is already allocated")
+	// ErrNotInPool is returned when an address isn't part of any usable pool.
+	ErrNotInPool = errors.New("address is not part of any pool")
+)
+
+// Allocator hands out addresses from a list of pools, making sure that no
+// address is given to more than one owner.
+type Allocator struct {
+	pools  []*Pool
+	owners map[netip.Addr]string
+}
+
+func NewAllocator(pools []*Pool) *Allocator {
+	return &Allocator{
+		pools:  pools,
+		owners: make(map[netip.Addr]string),
+	}
+}
+
+// Assign records an existing allocation of ip to owner. It is used to rebuild
+// the allocator state from the addresses already assigned to services.
+func (a *Allocator) Assign(owner, namespace string, ip netip.Addr) error {
+	ip = ip.Unmap()
+
+	pool := a.poolOf(ip)
+	if pool == nil {
+		return ErrNotInPool
+	}
+	if !pool.AllowsNamespace(namespace) {
+		return fmt.Errorf("pool %s is not available in namespace %s", pool.Name, namespace)
+	}
+	if current, ok := a.owners[ip]; ok && current != owner {
+		return fmt.Errorf("%s is owned by %s: %w", ip, current, ErrConflict)
+	}
+
+	a.owners[ip] = owner
+	return nil
+}
+
+// Allocate returns the lowest free address of the requested family from the
+// first matching pool and records owner as its owner. If poolName is not
+// empty, only that pool is considered.
+func (a *Allocator) Allocate(owner, namespace, poolName string, ipv6 bool) (netip.Addr, error) {
+	for _, pool := range a.pools {
+		if poolName != "" && pool.Name != poolName {
+			continue
+		}
+		if !pool.AllowsNamespace(namespace) {
+			continue
+		}
+
+		for _, r := range pool.ranges {
+			if r.first.Is6() != ipv6 {
+				continue
+			}
+			for ip := r.first; ip.IsValid() && ip.Compare(r.last) <= 0; ip = ip.Next() {
+				if _, used := a.owners[ip]; !used {
+					a.owners[ip] = owner
+					return ip, nil
+				}
+			}
+		}
+	}
+
+	family := "IPv4"
+	if ipv6 {
+		family = "IPv6"
+	}
+	if poolName != "" {
+		return netip.Addr{}, fmt.Errorf("no free %s address in pool %s for namespace %s", family, poolName, namespace)
+	}
+	return netip.Addr{}, fmt.Errorf("no free %s address in any pool for namespace %s", family, namespace)
+}
+
+func (a *Allocator) poolOf(ip netip.Addr) *Pool {
+	for _, pool := range a.pools {
+		if pool.Contains(ip) {
+			return pool
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package ipam
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func mustPool(t *testing.T, name string, addresses []string, namespaces ...string) *Pool {
+	t.Helper()
+	pool, err := NewPool(name, addresses, namespaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestAllocate(t *testing.T) {
+	type allocation struct {
+		owner, namespace, pool string
+		ipv6                   bool
+		want                   string // empty if no address is left
+	}
+
+	tests := []struct {
+		name        string
+		pools       []*Pool
+		allocations []allocation
+	}{
+		{
+			name:  "skips network and broadcast addresses",
+			pools: []*Pool{mustPool(t, "a", []string{"10.0.0.0/30"})},
+			allocations: []allocation{
+				{owner: "s1", want: "10.0.0.1"},
+				{owner: "s2", want: "10.0.0.2"},
+				{owner: "s3"},
+			},
+		},
+		{
+			name:  "moves on to the next pool",
+			pools: []*Pool{mustPool(t, "a", []string{"10.0.0.5/32"}), mustPool(t, "b", []string{"10.1.0.10-10.1.0.11"})},
+			allocations: []allocation{
+				{owner: "s1", want: "10.0.0.5"},
+				{owner: "s2", want: "10.1.0.10"},
+				{owner: "s3", pool: "a"},
+				{owner: "s4", pool: "b", want: "10.1.0.11"},
+			},
+		},
+		{
+			name: "respects namespace restrictions",
+			pools: []*Pool{
+				mustPool(t, "team", []string{"10.0.0.5/32"}, "team"),
+				mustPool(t, "shared", []string{"10.1.0.5/32"}),
+			},
+			allocations: []allocation{
+				{owner: "s1", namespace: "other", want: "10.1.0.5"},
+				{owner: "s2", namespace: "other"},
+				{owner: "s3", namespace: "other", pool: "team"},
+				{owner: "s4", namespace: "team", want: "10.0.0.5"},
+			},
+		},
+		{
+			name:  "allocates per family",
+			pools: []*Pool{mustPool(t, "a", []string{"10.0.0.5/32", "2001:db8::/127"})},
+			allocations: []allocation{
+				{owner: "s1", ipv6: true, want: "2001:db8::"},
+				{owner: "s1", want: "10.0.0.5"},
+				{owner: "s2", ipv6: true, want: "2001:db8::1"},
+				{owner: "s3", ipv6: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		allocator := NewAllocator(tt.pools)
+		for _, a := range tt.allocations {
+			ip, err := allocator.Allocate(a.owner, a.namespace, a.pool, a.ipv6)
+			if a.want == "" {
+				if err == nil {
+					t.Errorf("%s: expected no address for %s, got %s", tt.name, a.owner, ip)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %s", tt.name, err)
+				continue
+			}
+			if ip != netip.MustParseAddr(a.want) {
+				t.Errorf("%s: allocated %s for %s, expected %s", tt.name, ip, a.owner, a.want)
+			}
+		}
+	}
+}
+
+func TestAssign(t *testing.T) {
+	allocator := NewAllocator([]*Pool{
+		mustPool(t, "a", []string{"10.0.0.0/29"}),
+		mustPool(t, "team", []string{"10.1.0.0/29"}, "team"),
+	})
+
+	if err := allocator.Assign("s1", "default", netip.MustParseAddr("10.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := allocator.Assign("s1", "default", netip.MustParseAddr("10.0.0.1")); err != nil {
+		t.Errorf("expected assigning an address to its owner again to succeed, got %s", err)
+	}
+	if err := allocator.Assign("s2", "default", netip.MustParseAddr("10.0.0.1")); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	if err := allocator.Assign("s2", "default", netip.MustParseAddr("192.168.0.1")); !errors.Is(err, ErrNotInPool) {
+		t.Errorf("expected an address outside the pools to be reported, got %v", err)
+	}
+	if err := allocator.Assign("s2", "default", netip.MustParseAddr("10.1.0.1")); err == nil {
+		t.Error("expected an address of a pool restricted to another namespace to be refused")
+	}
+
+	// Assigned addresses aren't allocated again.
+	ip, err := allocator.Allocate("s3", "default", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != netip.MustParseAddr("10.0.0.2") {
+		t.Errorf("allocated %s, expected 10.0.0.2", ip)
+	}
+}
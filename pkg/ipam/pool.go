@@ -0,0 +1,119 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Pool is a named set of address ranges that LoadBalancer IPs are allocated from.
+type Pool struct {
+	Name string
+
+	ranges     []addrRange
+	namespaces map[string]struct{}
+}
+
+type addrRange struct {
+	first netip.Addr
+	last  netip.Addr
+}
+
+// NewPool creates a pool from a list of CIDRs ("10.0.0.0/24") or ranges
+// ("10.0.0.10-10.0.0.20"). If namespaces is not empty, only services in
+// these namespaces may get addresses from the pool.
+func NewPool(name string, addresses []string, namespaces []string) (*Pool, error) {
+	p := &Pool{
+		Name:       name,
+		namespaces: make(map[string]struct{}),
+	}
+
+	for _, address := range addresses {
+		r, err := parseRange(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address range %q in pool %s: %s", address, name, err)
+		}
+		p.ranges = append(p.ranges, r)
+	}
+	if len(p.ranges) == 0 {
+		return nil, fmt.Errorf("pool %s doesn't contain any addresses", name)
+	}
+
+	for _, ns := range namespaces {
+		p.namespaces[ns] = struct{}{}
+	}
+
+	return p, nil
+}
+
+// Contains checks whether the address is part of the pool.
+func (p *Pool) Contains(ip netip.Addr) bool {
+	for _, r := range p.ranges {
+		if r.contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsNamespace checks whether services in the namespace may use the pool.
+func (p *Pool) AllowsNamespace(namespace string) bool {
+	if len(p.namespaces) == 0 {
+		return true
+	}
+	_, ok := p.namespaces[namespace]
+	return ok
+}
+
+func (r addrRange) contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return r.first.BitLen() == ip.BitLen() && r.first.Compare(ip) <= 0 && ip.Compare(r.last) <= 0
+}
+
+func parseRange(s string) (addrRange, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return addrRange{}, err
+		}
+		prefix = prefix.Masked()
+		first, last := prefix.Addr(), lastAddr(prefix)
+		// The network and broadcast addresses of IPv4 subnets can't be
+		// used, except for point-to-point links (RFC 3021).
+		if first.Is4() && prefix.Bits() < 31 {
+			first, last = first.Next(), last.Prev()
+		}
+		return addrRange{first, last}, nil
+	}
+
+	first, last, found := strings.Cut(s, "-")
+	if !found {
+		return addrRange{}, fmt.Errorf("expected CIDR or range of the form first-last")
+	}
+	firstIP, err := netip.ParseAddr(strings.TrimSpace(first))
+	if err != nil {
+		return addrRange{}, err
+	}
+	lastIP, err := netip.ParseAddr(strings.TrimSpace(last))
+	if err != nil {
+		return addrRange{}, err
+	}
+	if firstIP.BitLen() != lastIP.BitLen() || firstIP.Compare(lastIP) > 0 {
+		return addrRange{}, fmt.Errorf("%s is not lower than %s or of another family", firstIP, lastIP)
+	}
+	return addrRange{firstIP, lastIP}, nil
+}
+
+// lastAddr returns the highest address of a masked prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	ip := prefix.Addr()
+	bytes := ip.AsSlice()
+	for bit := prefix.Bits(); bit < ip.BitLen(); bit++ {
+		bytes[bit/8] |= 1 << (7 - uint(bit%8))
+	}
+	last, _ := netip.AddrFromSlice(bytes)
+	return last
+}
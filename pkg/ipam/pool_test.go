@@ -0,0 +1,91 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package ipam
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		address     string
+		first, last string
+		invalid     bool
+	}{
+		{address: "10.0.0.0/24", first: "10.0.0.1", last: "10.0.0.254"},
+		{address: "10.0.0.17/24", first: "10.0.0.1", last: "10.0.0.254"},
+		{address: "10.0.0.0/30", first: "10.0.0.1", last: "10.0.0.2"},
+		{address: "10.0.0.0/31", first: "10.0.0.0", last: "10.0.0.1"},
+		{address: "10.0.0.5/32", first: "10.0.0.5", last: "10.0.0.5"},
+		{address: "2001:db8::/126", first: "2001:db8::", last: "2001:db8::3"},
+		{address: "10.0.0.10-10.0.0.20", first: "10.0.0.10", last: "10.0.0.20"},
+		{address: "10.0.0.10 - 10.0.0.10", first: "10.0.0.10", last: "10.0.0.10"},
+		{address: "2001:db8::1-2001:db8::ff", first: "2001:db8::1", last: "2001:db8::ff"},
+		{address: "10.0.0.0/33", invalid: true},
+		{address: "10.0.0.20-10.0.0.10", invalid: true},
+		{address: "10.0.0.1-2001:db8::1", invalid: true},
+		{address: "10.0.0.1", invalid: true},
+		{address: "10.0.0.x-10.0.0.2", invalid: true},
+	}
+
+	for _, tt := range tests {
+		r, err := parseRange(tt.address)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s-%s", tt.address, r.first, r.last)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.address, err)
+			continue
+		}
+		if r.first != netip.MustParseAddr(tt.first) || r.last != netip.MustParseAddr(tt.last) {
+			t.Errorf("%s: got %s-%s, expected %s-%s", tt.address, r.first, r.last, tt.first, tt.last)
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	pool, err := NewPool("a", []string{"10.0.0.0/30", "10.1.0.5-10.1.0.6"}, []string{"team"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contains := map[string]bool{
+		"10.0.0.0":        false,
+		"10.0.0.1":        true,
+		"10.0.0.2":        true,
+		"10.0.0.3":        false,
+		"10.1.0.4":        false,
+		"10.1.0.5":        true,
+		"10.1.0.6":        true,
+		"::ffff:10.0.0.1": true,
+		"2001:db8::1":     false,
+	}
+	for ip, want := range contains {
+		if got := pool.Contains(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Contains(%s) = %t, expected %t", ip, got, want)
+		}
+	}
+
+	if !pool.AllowsNamespace("team") || pool.AllowsNamespace("other") {
+		t.Error("expected the pool to be restricted to namespace team")
+	}
+	unrestricted, err := NewPool("b", []string{"10.2.0.0/24"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !unrestricted.AllowsNamespace("other") {
+		t.Error("expected a pool without namespaces to allow all namespaces")
+	}
+
+	if _, err := NewPool("c", nil, nil); err == nil {
+		t.Error("expected an error for a pool without addresses")
+	}
+	if _, err := NewPool("d", []string{"bogus"}, nil); err == nil {
+		t.Error("expected an error for a pool with an invalid range")
+	}
+}
@@ -4,42 +4,70 @@
 package metrics
 
 import (
+	"net"
+
 	"github.com/golang/glog"
+	gobgp "github.com/osrg/gobgp/packet/bgp"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sapcc/kube-parrot/pkg/bfd"
 	"github.com/sapcc/kube-parrot/pkg/bgp"
-	"net"
 )
 
 var sessionStati = []string{"idle", "connect", "active", "opensent", "openconfirm", "established"}
 
+var drainStati = []string{"announced", "depreferred", "withdrawn"}
+
+var routeFamilies = map[string]gobgp.RouteFamily{
+	"ipv4": gobgp.RF_IPv4_UC,
+	"ipv6": gobgp.RF_IPv6_UC,
+}
+
 type collector struct {
 	nodeName  string
 	neighbors []*net.IP
 	bgpServer *bgp.Server
+	bfdServer *bfd.Server
 
 	bgpServerErrorsTotal,
+	bgpSpeakerHealthyMetric,
 	bgpNeighborsSessionStatusMetric,
-	bgpNeighborAdvertisedRouteCountTotalMetric *prometheus.Desc
+	bgpNeighborAdvertisedRouteCountTotalMetric,
+	bgpNeighborAdvertisedPrefixCountMetric,
+	bfdSessionStatusMetric,
+	drainStatusMetric,
+	routePendingTransitionsMetric,
+	routeCancelledTransitionsTotal,
+	routeRefusedMetric,
+	routeRefusalsTotal,
+	routeConflictsMetric *prometheus.Desc
 }
 
 // RegisterCollector registers a new Prometheus metrics collector.
-func RegisterCollector(nodeName string, neighbors []*net.IP, bgpServer *bgp.Server) {
+// bfdServer may be nil if BFD is disabled.
+func RegisterCollector(nodeName string, neighbors []*net.IP, bgpServer *bgp.Server, bfdServer *bfd.Server) {
 	prometheus.MustRegister(
-		newCollector(nodeName, neighbors, bgpServer),
+		newCollector(nodeName, neighbors, bgpServer, bfdServer),
 	)
 }
 
-func newCollector(nodeName string, neighbors []*net.IP, bgpServer *bgp.Server) *collector {
+func newCollector(nodeName string, neighbors []*net.IP, bgpServer *bgp.Server, bfdServer *bfd.Server) *collector {
 	return &collector{
 		nodeName:  nodeName,
 		neighbors: neighbors,
 		bgpServer: bgpServer,
+		bfdServer: bfdServer,
 		bgpServerErrorsTotal: prometheus.NewDesc(
 			"kube_parrot_bgp_server_errors_total",
 			"Counter for BGP server errors.",
 			[]string{"node"},
 			nil,
 		),
+		bgpSpeakerHealthyMetric: prometheus.NewDesc(
+			"kube_parrot_bgp_speaker_healthy",
+			"Whether the BGP speaker applied the announced routes, e.g. whether the last reload of the routing daemon succeeded.",
+			[]string{"node"},
+			nil,
+		),
 		bgpNeighborsSessionStatusMetric: prometheus.NewDesc(
 			"kube_parrot_bgp_neighbor_session_status",
 			"Session status of BGP neighbors.",
@@ -52,20 +80,160 @@ func newCollector(nodeName string, neighbors []*net.IP, bgpServer *bgp.Server) *
 			[]string{"node", "neighbor"},
 			nil,
 		),
+		bgpNeighborAdvertisedPrefixCountMetric: prometheus.NewDesc(
+			"kube_parrot_bgp_neighbor_advertised_prefix_count",
+			"Count of prefixes advertised to BGP neighbor per address family.",
+			[]string{"node", "neighbor", "family"},
+			nil,
+		),
+		bfdSessionStatusMetric: prometheus.NewDesc(
+			"kube_parrot_bfd_session_status",
+			"Status of BFD sessions with BGP neighbors.",
+			[]string{"node", "neighbor", "status"},
+			nil,
+		),
+		drainStatusMetric: prometheus.NewDesc(
+			"kube_parrot_drain_status",
+			"Whether the routes of the node are announced, depreferred or withdrawn.",
+			[]string{"node", "status"},
+			nil,
+		),
+		routePendingTransitionsMetric: prometheus.NewDesc(
+			"kube_parrot_route_pending_transitions",
+			"Count of route announcements and withdrawals waiting for their hold-down to pass.",
+			[]string{"node", "transition"},
+			nil,
+		),
+		routeCancelledTransitionsTotal: prometheus.NewDesc(
+			"kube_parrot_route_cancelled_transitions_total",
+			"Counter for route announcements and withdrawals reverted during their hold-down.",
+			[]string{"node"},
+			nil,
+		),
+		routeRefusedMetric: prometheus.NewDesc(
+			"kube_parrot_route_refused",
+			"Count of service routes not announced, because their prefix isn't allowed.",
+			[]string{"node"},
+			nil,
+		),
+		routeRefusalsTotal: prometheus.NewDesc(
+			"kube_parrot_route_refusals_total",
+			"Counter for service routes refused, because their prefix isn't allowed.",
+			[]string{"node"},
+			nil,
+		),
+		routeConflictsMetric: prometheus.NewDesc(
+			"kube_parrot_route_conflicts",
+			"Count of prefixes claimed by more than one service.",
+			[]string{"node"},
+			nil,
+		),
 	}
 }
 
 func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.bgpServerErrorsTotal
+	ch <- c.bgpSpeakerHealthyMetric
 	ch <- c.bgpNeighborsSessionStatusMetric
 	ch <- c.bgpNeighborAdvertisedRouteCountTotalMetric
+	ch <- c.bgpNeighborAdvertisedPrefixCountMetric
+	ch <- c.bfdSessionStatusMetric
+	ch <- c.drainStatusMetric
+	ch <- c.routePendingTransitionsMetric
+	ch <- c.routeCancelledTransitionsTotal
+	ch <- c.routeRefusedMetric
+	ch <- c.routeRefusalsTotal
+	ch <- c.routeConflictsMetric
 }
 
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	// Report the drain status of the node.
+	withdrawn, depreferred := c.bgpServer.AnnouncementState()
+	status := "announced"
+	if withdrawn {
+		status = "withdrawn"
+	} else if depreferred {
+		status = "depreferred"
+	}
+	for _, s := range drainStati {
+		ch <- prometheus.MustNewConstMetric(
+			c.drainStatusMetric,
+			prometheus.GaugeValue,
+			boolToFloat64(status == s),
+			c.nodeName,
+			s,
+		)
+	}
+
+	// Report route transitions held down.
+	announcements, withdrawals := c.bgpServer.PendingTransitions()
+	ch <- prometheus.MustNewConstMetric(
+		c.routePendingTransitionsMetric,
+		prometheus.GaugeValue,
+		float64(announcements),
+		c.nodeName,
+		"announcement",
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.routePendingTransitionsMetric,
+		prometheus.GaugeValue,
+		float64(withdrawals),
+		c.nodeName,
+		"withdrawal",
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.routeCancelledTransitionsTotal,
+		prometheus.CounterValue,
+		float64(c.bgpServer.CancelledTransitions()),
+		c.nodeName,
+	)
+
+	// Report routes refused by the prefix policy.
+	ch <- prometheus.MustNewConstMetric(
+		c.routeRefusedMetric,
+		prometheus.GaugeValue,
+		float64(c.bgpServer.RefusedRoutes()),
+		c.nodeName,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		c.routeRefusalsTotal,
+		prometheus.CounterValue,
+		float64(c.bgpServer.Refusals()),
+		c.nodeName,
+	)
+
+	// Report prefixes claimed by several services.
+	ch <- prometheus.MustNewConstMetric(
+		c.routeConflictsMetric,
+		prometheus.GaugeValue,
+		float64(c.bgpServer.Conflicts()),
+		c.nodeName,
+	)
+
+	// Report whether the speaker applied the routes.
+	ch <- prometheus.MustNewConstMetric(
+		c.bgpSpeakerHealthyMetric,
+		prometheus.GaugeValue,
+		boolToFloat64(c.bgpServer.SpeakerHealthy() == nil),
+		c.nodeName,
+	)
+
+	peers, err := c.bgpServer.Peers()
+	if err != nil {
+		glog.Infof("failed to get session status for BGP neighbors: %v", err)
+		ch <- prometheus.MustNewConstMetric(
+			c.bgpServerErrorsTotal,
+			prometheus.CounterValue,
+			1,
+			c.nodeName,
+		)
+		return
+	}
+
 	for _, neighbor := range c.neighbors {
-		neighborList, err := c.bgpServer.GetNeighbor(neighbor.String())
-		if err != nil {
-			glog.Infof("failed to get session status for BGP neighbor: %v", err)
+		peer, ok := findPeer(peers, neighbor.String())
+		if !ok {
+			glog.Infof("failed to get session status for BGP neighbor %s", neighbor)
 			ch <- prometheus.MustNewConstMetric(
 				c.bgpServerErrorsTotal,
 				prometheus.CounterValue,
@@ -75,30 +243,68 @@ func (c *collector) Collect(ch chan<- prometheus.Metric) {
 			continue
 		}
 
-		for _, n := range neighborList {
-			// Report BGP sessions status metrics.
-			for _, status := range sessionStati {
-				ch <- prometheus.MustNewConstMetric(
-					c.bgpNeighborsSessionStatusMetric,
-					prometheus.GaugeValue,
-					boolToFloat64(n.GetInfo().GetBgpState() == status),
-					c.nodeName,
-					neighbor.String(),
-					status,
-				)
+		// Report BGP sessions status metrics.
+		for _, status := range sessionStati {
+			ch <- prometheus.MustNewConstMetric(
+				c.bgpNeighborsSessionStatusMetric,
+				prometheus.GaugeValue,
+				boolToFloat64(peer.State == status),
+				c.nodeName,
+				neighbor.String(),
+				status,
+			)
+		}
+
+		// Report count of advertised routes.
+		ch <- prometheus.MustNewConstMetric(
+			c.bgpNeighborAdvertisedRouteCountTotalMetric,
+			prometheus.GaugeValue,
+			float64(peer.Advertised),
+			c.nodeName,
+			neighbor.String(),
+		)
+
+		// Report BFD session status metrics.
+		if c.bfdServer != nil {
+			if state, ok := c.bfdServer.GetState(neighbor.String()); ok {
+				for _, s := range bfd.States {
+					ch <- prometheus.MustNewConstMetric(
+						c.bfdSessionStatusMetric,
+						prometheus.GaugeValue,
+						boolToFloat64(state == s),
+						c.nodeName,
+						neighbor.String(),
+						s.String(),
+					)
+				}
 			}
+		}
 
-			// Report count of advertised routes.
+		// Report advertised prefixes per address family.
+		for name, family := range routeFamilies {
+			count, ok := peer.AdvertisedPrefixes[family]
+			if !ok {
+				continue
+			}
 			ch <- prometheus.MustNewConstMetric(
-				c.bgpNeighborAdvertisedRouteCountTotalMetric,
+				c.bgpNeighborAdvertisedPrefixCountMetric,
 				prometheus.GaugeValue,
-				float64(n.GetInfo().GetAdvertised()),
+				float64(count),
 				c.nodeName,
 				neighbor.String(),
+				name,
 			)
+		}
+	}
+}
 
+func findPeer(peers []bgp.Peer, address string) (bgp.Peer, bool) {
+	for _, peer := range peers {
+		if peer.Address == address {
+			return peer, true
 		}
 	}
+	return bgp.Peer{}, false
 }
 
 func boolToFloat64(b bool) float64 {
@@ -13,8 +13,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// ServeMetrics starts the Prometheus metrics collector.
-func ServeMetrics(host net.IP, port int, wg *sync.WaitGroup, stop <-chan struct{}) {
+// ServeMetrics starts the Prometheus metrics collector. routes is served on
+// /routes, if it isn't nil.
+func ServeMetrics(host net.IP, port int, routes http.Handler, wg *sync.WaitGroup, stop <-chan struct{}) {
 	wg.Add(1)
 	defer wg.Done()
 
@@ -27,6 +28,12 @@ func ServeMetrics(host net.IP, port int, wg *sync.WaitGroup, stop <-chan struct{
 	defer l.Close()
 	glog.Infof("Serving Prometheus metrics on %s", addr)
 
-	go http.Serve(l, promhttp.Handler())
+	mux := http.NewServeMux()
+	mux.Handle("/", promhttp.Handler())
+	if routes != nil {
+		mux.Handle("/routes", routes)
+	}
+
+	go http.Serve(l, mux)
 	<-stop
 }
@@ -6,13 +6,18 @@ package parrot
 import (
 	"fmt"
 	"net"
+	"net/http"
 	"sync"
 	"time"
 
+	"github.com/golang/glog"
+	"github.com/sapcc/kube-parrot/pkg/bfd"
 	"github.com/sapcc/kube-parrot/pkg/bgp"
 	"github.com/sapcc/kube-parrot/pkg/controller"
 	"github.com/sapcc/kube-parrot/pkg/forked/informer"
+	"github.com/sapcc/kube-parrot/pkg/ipam"
 	"github.com/sapcc/kube-parrot/pkg/metrics"
+	"github.com/sapcc/kube-parrot/pkg/util"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 )
@@ -21,17 +26,47 @@ var (
 	VERSION = "0.0.0.dev"
 )
 
+// defaultReconcileTimeout bounds the wait for the initial reconcile if
+// graceful restart is disabled.
+const defaultReconcileTimeout = 30 * time.Second
+
 type Options struct {
 	GrpcPort      int
 	As            int
 	RemoteAs      int
 	NodeName      string
 	HostIP        net.IP
-	Neighbors     []*net.IP
+	HostIPv6      net.IP
+	Neighbors     []util.Neighbor
 	MetricsPort   int
 	TraceCount    int
 	NeighborCount int
 	PodSubnet     bool
+
+	// Daemon drives an external routing daemon instead of the embedded
+	// GoBGP, if its Daemon is set.
+	Daemon bgp.DaemonOptions
+	// DryRun computes the routes without announcing them. No sessions are
+	// opened and nothing is written to the API.
+	DryRun bool
+
+	LoadBalancerClass string
+	ServiceSelector   controller.ServiceSelector
+
+	KubeProxyWatchdog  bool
+	KubeProxyStaleTime time.Duration
+
+	GracefulRestartTime          time.Duration
+	LongLivedGracefulRestartTime time.Duration
+
+	Shutdown bgp.ShutdownOptions
+	HoldDown bgp.HoldDown
+	Drain    controller.DrainOptions
+
+	BFD           bool
+	BFDMinTx      time.Duration
+	BFDMinRx      time.Duration
+	BFDMultiplier int
 }
 
 type Parrot struct {
@@ -39,29 +74,114 @@ type Parrot struct {
 
 	client *kubernetes.Clientset
 	bgp    *bgp.Server
+	bfd    *bfd.Server
+	// dryRun keeps the routes that would be announced in a dry run.
+	dryRun *bgp.MemorySpeaker
 
-	informers       informer.SharedInformerFactory
-	externalSevices *controller.ExternalServicesController
-	podSubnets      *controller.PodSubnetsController
+	informers         informer.SharedInformerFactory
+	neighborPasswords *controller.NeighborPasswordsController
+	kubeProxy         *controller.KubeProxyWatchdog
+	drain             *controller.NodeDrainController
+	externalSevices   *controller.ExternalServicesController
+	podSubnets        *controller.PodSubnetsController
+	loadBalancerIPs   *controller.LoadBalancerIPsController
 }
 
 func New(opts Options) *Parrot {
+	if _, err := bgp.ParseCommunities(util.GetConfig().Communities); err != nil {
+		glog.Fatalf("Invalid default communities in config: %s", err)
+	}
+
 	p := &Parrot{
 		Options: opts,
-		bgp:     bgp.NewServer(&opts.HostIP, opts.As, opts.RemoteAs, opts.GrpcPort),
 		client:  NewClient(),
 	}
 
+	if opts.DryRun {
+		glog.Infof("Dry run. Routes are computed, but not announced")
+		p.dryRun = bgp.NewMemorySpeaker(false)
+		p.bgp = bgp.NewServer(p.dryRun, &opts.HostIP, opts.As, opts.RemoteAs)
+	} else {
+		p.bgp = bgp.NewServer(newSpeaker(opts), &opts.HostIP, opts.As, opts.RemoteAs)
+	}
+
+	p.bgp.SetShutdownOptions(opts.Shutdown)
+	p.bgp.SetPrefixPolicy(prefixPolicy())
+	if opts.GracefulRestartTime > 0 {
+		p.bgp.EnableGracefulRestart(opts.GracefulRestartTime, opts.LongLivedGracefulRestartTime)
+	}
+
+	if opts.BFD && !opts.DryRun {
+		p.bfd = bfd.NewServer(opts.HostIP, bfd.Config{
+			DesiredMinTxInterval:  opts.BFDMinTx,
+			RequiredMinRxInterval: opts.BFDMinRx,
+			DetectMultiplier:      uint8(opts.BFDMultiplier),
+		}, p.bfdStateChanged)
+	}
+
 	// Register parrot prometheus metrics collector.
-	metrics.RegisterCollector(p.NodeName, opts.Neighbors, p.bgp)
+	metrics.RegisterCollector(p.NodeName, p.neighborIPs(), p.bgp, p.bfd)
 
+	p.neighborPasswords = controller.NewNeighborPasswordsController(p.client, p.bgp, opts.Neighbors)
 	p.informers = informer.NewSharedInformerFactory(p.client, 5*time.Minute)
-	p.externalSevices = controller.NewExternalServicesController(p.informers, &opts.HostIP, opts.NodeName, p.bgp.ExternalIPRoutes)
+	if opts.KubeProxyWatchdog {
+		p.kubeProxy = controller.NewKubeProxyWatchdog(p.client, opts.NodeName, opts.HostIP, opts.KubeProxyStaleTime)
+	}
+	p.drain = controller.NewNodeDrainController(p.informers, opts.NodeName, p.bgp, opts.Drain)
+	// Events about routes that weren't announced would be misleading in a
+	// dry run.
+	var events kubernetes.Interface = p.client
+	if opts.DryRun {
+		events = nil
+	}
+	p.externalSevices = controller.NewExternalServicesController(p.informers, events, &opts.HostIP, &opts.HostIPv6, opts.NodeName,
+		opts.LoadBalancerClass, p.bgp.ExternalIPRoutes, p.bgp.LoadBalancerIPRoutes, p.kubeProxy, opts.ServiceSelector)
 	p.podSubnets = controller.NewPodSubnetsController(p.informers, &opts.HostIP, p.bgp.NodePodSubnetRoutes)
 
+	// Allocating IPs would race with the parrots that aren't dry running.
+	if pools := addressPools(); opts.LoadBalancerClass != "" && len(pools) > 0 && !opts.DryRun {
+		p.loadBalancerIPs = controller.NewLoadBalancerIPsController(p.informers, p.client, opts.NodeName, opts.LoadBalancerClass, pools)
+	}
+
 	return p
 }
 
+// newSpeaker returns the embedded GoBGP, unless a routing daemon is
+// configured.
+func newSpeaker(opts Options) bgp.Speaker {
+	if opts.Daemon.Daemon == "" {
+		return bgp.NewGoBGPSpeaker(opts.GrpcPort)
+	}
+
+	speaker, err := bgp.NewDaemonSpeaker(opts.Daemon)
+	if err != nil {
+		glog.Fatalf("Invalid routing daemon: %s", err)
+	}
+	return speaker
+}
+
+// prefixPolicy restricts service routes to the allowed prefixes of the
+// config. The config is validated on load, so an invalid prefix is fatal.
+func prefixPolicy() *bgp.PrefixPolicy {
+	policy, err := bgp.NewPrefixPolicy(util.GetConfig().AllowedPrefixes)
+	if err != nil {
+		glog.Fatalf("Invalid allowed prefixes: %s", err)
+	}
+	return policy
+}
+
+func addressPools() (pools []*ipam.Pool) {
+	for _, c := range util.GetConfig().AddressPools {
+		pool, err := ipam.NewPool(c.Name, c.Addresses, c.Namespaces)
+		if err != nil {
+			glog.Errorf("Ignoring address pool: %s", err)
+			continue
+		}
+		pools = append(pools, pool)
+	}
+	return pools
+}
+
 func (p *Parrot) Run(opts Options, stopCh <-chan struct{}, wg *sync.WaitGroup) {
 	fmt.Printf("Welcome to Kubernetes Parrot %v\n", VERSION)
 
@@ -71,19 +191,134 @@ func (p *Parrot) Run(opts Options, stopCh <-chan struct{}, wg *sync.WaitGroup) {
 	// Wait for BGP main loop
 	time.Sleep(2 * time.Second)
 
-	for _, neighbor := range p.Neighbors {
-		p.bgp.AddNeighbor(neighbor.String())
+	if p.bfd != nil {
+		go p.bfd.Run(stopCh, wg)
+	}
+
+	// Passwords have to be known before the neighbors are added, otherwise
+	// the first connection attempts go out unauthenticated.
+	if p.neighborPasswords.HasNeighbors() {
+		go p.neighborPasswords.Run(stopCh, wg)
+		p.neighborPasswords.WaitForSync(stopCh)
 	}
 
-	cache.WaitForCacheSync(
-		stopCh,
-		p.informers.Endpoints().Informer().HasSynced,
+	synced := []cache.InformerSynced{
+		p.informers.EndpointSlices().Informer().HasSynced,
 		p.informers.Nodes().Informer().HasSynced,
 		p.informers.Services().Informer().HasSynced,
-	)
+	}
+	if p.ServiceSelector.Namespaces != nil {
+		synced = append(synced, p.informers.Namespaces().Informer().HasSynced)
+	}
+	cache.WaitForCacheSync(stopCh, synced...)
+
+	// Routes aren't announced before the state of kube-proxy is known.
+	if p.kubeProxy != nil {
+		go p.kubeProxy.Run(stopCh, wg)
+		p.kubeProxy.WaitForSync(stopCh)
+	}
 
+	// The drain state is known before the first routes are announced, so a
+	// draining node doesn't attract traffic after a restart.
+	go p.drain.Run(stopCh, wg)
 	go p.externalSevices.Run(stopCh, wg)
 	if opts.PodSubnet {
 		go p.podSubnets.Run(stopCh, wg)
 	}
+	if p.loadBalancerIPs != nil {
+		go p.loadBalancerIPs.Run(stopCh, wg)
+	}
+
+	// Neighbors are only added once all routes are in the RIB. GoBGP sends
+	// them in the initial update, followed by End-of-RIB, which makes
+	// gracefully restarting neighbors drop the stale routes of the previous
+	// run. Until then they keep forwarding to this node.
+	p.waitForReconcile(stopCh)
+
+	// The hold-down only applies from now on. Otherwise, it would delay the
+	// initial announcements past End-of-RIB.
+	p.bgp.SetHoldDown(opts.HoldDown)
+
+	if p.DryRun {
+		p.logDryRun()
+		return
+	}
+
+	for _, neighbor := range p.Neighbors {
+		p.bgp.AddNeighbor(neighbor)
+		if p.bfd != nil {
+			if err := p.bfd.AddPeer(neighbor.IP()); err != nil {
+				glog.Errorf("Couldn't start BFD session with %s: %s", neighbor, err)
+			}
+		}
+	}
+}
+
+// waitForReconcile blocks until the controllers announced their routes for
+// the first time. It gives up after the graceful restart time, as neighbors
+// flush the stale routes by then anyway.
+func (p *Parrot) waitForReconcile(stopCh <-chan struct{}) {
+	timeout := p.GracefulRestartTime
+	if timeout == 0 {
+		timeout = defaultReconcileTimeout
+	}
+	deadline := time.After(timeout)
+
+	reconciled := []<-chan struct{}{p.drain.Reconciled(), p.externalSevices.Reconciled()}
+	if p.PodSubnet {
+		reconciled = append(reconciled, p.podSubnets.Reconciled())
+	}
+
+	for _, ch := range reconciled {
+		select {
+		case <-ch:
+		case <-deadline:
+			glog.Errorf("Initial reconcile didn't finish within %s. Adding neighbors anyway", timeout)
+			return
+		case <-stopCh:
+			return
+		}
+	}
+	glog.Infof("Initial reconcile finished")
+}
+
+// logDryRun logs the routes that would be announced to the neighbors.
+func (p *Parrot) logDryRun() {
+	routes := p.dryRun.Routes()
+	glog.Infof("Dry run. Would announce %d routes to %d neighbors", len(routes), len(p.Neighbors))
+	for _, route := range routes {
+		glog.Infof("Would announce %s", route)
+	}
+}
+
+// RoutesHandler serves the routes that would be announced in a dry run. It
+// is nil otherwise.
+func (p *Parrot) RoutesHandler() http.Handler {
+	if p.dryRun == nil {
+		return nil
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, route := range p.dryRun.Routes() {
+			fmt.Fprintln(w, route)
+		}
+	})
+}
+
+func (p *Parrot) neighborIPs() (ips []*net.IP) {
+	for _, neighbor := range p.Neighbors {
+		ip := neighbor.IP()
+		ips = append(ips, &ip)
+	}
+	return ips
+}
+
+// bfdStateChanged tears down the BGP session when BFD detects that the
+// neighbor went away, instead of waiting for the hold timer to expire.
+func (p *Parrot) bfdStateChanged(peer string, old, new bfd.State) {
+	if old == bfd.StateUp && new == bfd.StateDown {
+		if err := p.bgp.ResetNeighbor(peer, "BFD session down"); err != nil {
+			glog.Errorf("Couldn't reset neighbor %s: %s", peer, err)
+		}
+	}
 }
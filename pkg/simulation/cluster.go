@@ -0,0 +1,281 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package simulation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// watchBuffer is the number of events a watcher buffers. Changes block
+	// once it is full, until the informer caught up.
+	watchBuffer = 100
+	// eventHistory is the number of events kept per kind. Watches starting
+	// at an older resource version fail, so the informer lists again.
+	eventHistory = 1000
+)
+
+// Cluster is an in-memory API server for the kinds of objects parrot
+// watches. Changes are sent to the informers listing and watching it.
+type Cluster struct {
+	mu              sync.Mutex
+	resourceVersion uint64
+	kinds           map[reflect.Type]*kind
+
+	// deliverMu keeps the events of concurrent changes in order. Events
+	// are delivered without holding mu, as watchers might block until the
+	// informer, which lists and watches, caught up.
+	deliverMu sync.Mutex
+}
+
+type kind struct {
+	newList         func() runtime.Object
+	objects         map[string]runtime.Object
+	resourceVersion uint64
+	// events are kept, so a watch can start at the resource version of a
+	// preceding list, like it does with a real API server. compacted is
+	// the resource version of the last event dropped from the history.
+	events    []watch.Event
+	compacted uint64
+	watchers  []*watcher
+}
+
+// delivery is an event to send to the watchers of a kind at the time of
+// the change.
+type delivery struct {
+	event    watch.Event
+	watchers []*watcher
+}
+
+type watcher struct {
+	*watch.ProxyWatcher
+	events chan watch.Event
+}
+
+func NewCluster() *Cluster {
+	c := &Cluster{kinds: map[reflect.Type]*kind{}}
+	c.register(&v1.Service{}, func() runtime.Object { return &v1.ServiceList{} })
+	c.register(&v1.Node{}, func() runtime.Object { return &v1.NodeList{} })
+	c.register(&v1.Pod{}, func() runtime.Object { return &v1.PodList{} })
+	c.register(&v1.Namespace{}, func() runtime.Object { return &v1.NamespaceList{} })
+	c.register(&discoveryv1.EndpointSlice{}, func() runtime.Object { return &discoveryv1.EndpointSliceList{} })
+	return c
+}
+
+func (c *Cluster) register(obj runtime.Object, newList func() runtime.Object) {
+	c.kinds[reflect.TypeOf(obj)] = &kind{newList: newList, objects: map[string]runtime.Object{}}
+}
+
+// Apply creates objects or replaces them, if they already exist.
+func (c *Cluster) Apply(objs ...runtime.Object) error {
+	c.deliverMu.Lock()
+	defer c.deliverMu.Unlock()
+
+	deliveries, err := c.apply(objs)
+	deliver(deliveries)
+	return err
+}
+
+func (c *Cluster) apply(objs []runtime.Object) (deliveries []delivery, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, obj := range objs {
+		k, key, err := c.lookup(obj)
+		if err != nil {
+			return deliveries, err
+		}
+
+		obj = obj.DeepCopyObject()
+		c.resourceVersion++
+		k.resourceVersion = c.resourceVersion
+		m, _ := meta.Accessor(obj)
+		m.SetResourceVersion(strconv.FormatUint(c.resourceVersion, 10))
+
+		event := watch.Added
+		if _, exists := k.objects[key]; exists {
+			event = watch.Modified
+		}
+		k.objects[key] = obj
+		deliveries = append(deliveries, k.record(watch.Event{Type: event, Object: obj.DeepCopyObject()}))
+	}
+	return deliveries, nil
+}
+
+// Delete deletes objects. Objects that don't exist are ignored.
+func (c *Cluster) Delete(objs ...runtime.Object) error {
+	c.deliverMu.Lock()
+	defer c.deliverMu.Unlock()
+
+	deliveries, err := c.delete(objs)
+	deliver(deliveries)
+	return err
+}
+
+func (c *Cluster) delete(objs []runtime.Object) (deliveries []delivery, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, obj := range objs {
+		k, key, err := c.lookup(obj)
+		if err != nil {
+			return deliveries, err
+		}
+
+		old, exists := k.objects[key]
+		if !exists {
+			continue
+		}
+		delete(k.objects, key)
+
+		c.resourceVersion++
+		k.resourceVersion = c.resourceVersion
+		old = old.DeepCopyObject()
+		m, _ := meta.Accessor(old)
+		m.SetResourceVersion(strconv.FormatUint(c.resourceVersion, 10))
+		deliveries = append(deliveries, k.record(watch.Event{Type: watch.Deleted, Object: old}))
+	}
+	return deliveries, nil
+}
+
+// Supports checks whether objects of the same type as obj can be applied.
+func (c *Cluster) Supports(obj runtime.Object) bool {
+	_, ok := c.kinds[reflect.TypeOf(obj)]
+	return ok
+}
+
+func (c *Cluster) lookup(obj runtime.Object) (*kind, string, error) {
+	k, ok := c.kinds[reflect.TypeOf(obj)]
+	if !ok {
+		return nil, "", fmt.Errorf("Oops. Something went wrong. Unsupported object %T", obj)
+	}
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return nil, "", err
+	}
+	return k, key, nil
+}
+
+// ResourceVersion returns the resource version of the last change of the
+// objects of the given type.
+func (c *Cluster) ResourceVersion(obj runtime.Object) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return strconv.FormatUint(c.kinds[reflect.TypeOf(obj)].resourceVersion, 10)
+}
+
+// ListWatch lists and watches the objects of the given type.
+func (c *Cluster) ListWatch(obj runtime.Object) cache.ListerWatcher {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.kinds[reflect.TypeOf(obj)].list()
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.kinds[reflect.TypeOf(obj)].watch(options.ResourceVersion)
+		},
+	}
+}
+
+func (k *kind) list() (runtime.Object, error) {
+	list := k.newList()
+	items := make([]runtime.Object, 0, len(k.objects))
+	for _, obj := range k.objects {
+		items = append(items, obj.DeepCopyObject())
+	}
+	if err := meta.SetList(list, items); err != nil {
+		return nil, err
+	}
+	m, err := meta.ListAccessor(list)
+	if err != nil {
+		return nil, err
+	}
+	m.SetResourceVersion(strconv.FormatUint(k.resourceVersion, 10))
+	return list, nil
+}
+
+// watch returns a watcher that starts with the events after the given
+// resource version.
+func (k *kind) watch(resourceVersion string) (watch.Interface, error) {
+	since, err := strconv.ParseUint(resourceVersion, 10, 64)
+	if resourceVersion == "" {
+		since, err = k.resourceVersion, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Oops. Something went wrong. Invalid resource version %q", resourceVersion)
+	}
+	if since < k.compacted {
+		return nil, apierrors.NewResourceExpired(fmt.Sprintf("too old resource version: %d (%d)", since, k.compacted))
+	}
+
+	// The events since then always fit into the buffer, as nobody reads
+	// from the watcher yet.
+	missed := k.eventsSince(since)
+	w := &watcher{events: make(chan watch.Event, len(missed)+watchBuffer)}
+	w.ProxyWatcher = watch.NewProxyWatcher(w.events)
+	for _, event := range missed {
+		w.events <- event
+	}
+	k.watchers = append(k.watchers, w)
+	return w, nil
+}
+
+func (k *kind) eventsSince(since uint64) (events []watch.Event) {
+	for _, event := range k.events {
+		m, _ := meta.Accessor(event.Object)
+		if rv, _ := strconv.ParseUint(m.GetResourceVersion(), 10, 64); rv > since {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// record adds an event to the history and returns its delivery to the
+// current watchers. Watchers that were stopped are dropped.
+func (k *kind) record(event watch.Event) delivery {
+	k.events = append(k.events, event)
+	if dropped := len(k.events) - eventHistory; dropped > 0 {
+		m, _ := meta.Accessor(k.events[dropped-1].Object)
+		k.compacted, _ = strconv.ParseUint(m.GetResourceVersion(), 10, 64)
+		k.events = append([]watch.Event(nil), k.events[dropped:]...)
+	}
+
+	watchers := k.watchers[:0]
+	for _, w := range k.watchers {
+		if !w.Stopping() {
+			watchers = append(watchers, w)
+		}
+	}
+	k.watchers = watchers
+	return delivery{event: event, watchers: append([]*watcher(nil), watchers...)}
+}
+
+// deliver passes events to their watchers. It blocks while a watcher's
+// buffer is full, until the watcher is read from or stopped.
+func deliver(deliveries []delivery) {
+	for _, d := range deliveries {
+		for _, w := range d.watchers {
+			select {
+			case w.events <- d.event:
+			case <-w.StopChan():
+			}
+		}
+	}
+}
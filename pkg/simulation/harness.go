@@ -0,0 +1,171 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+// Package simulation runs the controllers of parrot against an in-memory
+// cluster and records what they announce, so scenarios can be scripted
+// without an API server or BGP neighbors.
+//
+// The cluster is hand-written instead of using the fake clientset of
+// client-go, because the tracker of the fake clientset neither assigns
+// resource versions nor resumes watches at one. Settle compares the resource
+// version the informers last synced with the one of the cluster to tell
+// whether the controllers saw all changes, and informers relisting after a
+// compacted watch history are part of what the harness exercises.
+package simulation
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sapcc/kube-parrot/pkg/bgp"
+	"github.com/sapcc/kube-parrot/pkg/controller"
+	"github.com/sapcc/kube-parrot/pkg/healthcheck"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// settleQuiet is how long announcements must not change for the
+	// controllers to count as settled.
+	settleQuiet = 200 * time.Millisecond
+	// settleTimeout bounds the wait for the informers and controllers.
+	settleTimeout = 10 * time.Second
+)
+
+// Options describe the simulated node.
+type Options struct {
+	As       int
+	RemoteAs int
+	NodeName string
+	HostIP   net.IP
+	HostIPv6 net.IP
+
+	// PodSubnet announces the pod CIDRs of the node.
+	PodSubnet bool
+
+	LoadBalancerClass string
+	ServiceSelector   controller.ServiceSelector
+	// PrefixPolicy restricts service routes. nil allows all prefixes.
+	PrefixPolicy *bgp.PrefixPolicy
+	// HoldDown delays announcements and withdrawals of service routes.
+	HoldDown bgp.HoldDown
+	// AssumeHealthy lets all health checks of services pass instead of
+	// probing them from this machine.
+	AssumeHealthy bool
+	// Drain runs the NodeDrainController with these options. Disabled if
+	// nil.
+	Drain *controller.DrainOptions
+}
+
+// Harness runs the ExternalServicesController and, if enabled, the
+// PodSubnetsController and NodeDrainController of a single node. Changes to the cluster are picked
+// up like changes to the API. The server isn't run, as the memory speaker
+// needs neither to be started nor to be shut down.
+type Harness struct {
+	*Cluster
+	Options
+
+	Speaker *bgp.MemorySpeaker
+	Server  *bgp.Server
+
+	informers        *informerFactory
+	externalServices *controller.ExternalServicesController
+	podSubnets       *controller.PodSubnetsController
+	drain            *controller.NodeDrainController
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func New(opts Options) *Harness {
+	h := &Harness{
+		Cluster: NewCluster(),
+		Options: opts,
+		Speaker: bgp.NewMemorySpeaker(true),
+		stopCh:  make(chan struct{}),
+	}
+
+	h.Server = bgp.NewServer(h.Speaker, &h.HostIP, opts.As, opts.RemoteAs)
+	h.Server.SetPrefixPolicy(opts.PrefixPolicy)
+	h.Server.SetHoldDown(opts.HoldDown)
+
+	h.informers = newInformerFactory(h.Cluster)
+	h.externalServices = controller.NewExternalServicesController(h.informers, nil, &h.HostIP, &h.HostIPv6, opts.NodeName,
+		opts.LoadBalancerClass, h.Server.ExternalIPRoutes, h.Server.LoadBalancerIPRoutes, nil, opts.ServiceSelector)
+	if opts.AssumeHealthy {
+		h.externalServices.SetHealthChecker(healthcheck.Passing{})
+	}
+	h.podSubnets = controller.NewPodSubnetsController(h.informers, &h.HostIP, h.Server.NodePodSubnetRoutes)
+	if opts.Drain != nil {
+		h.drain = controller.NewNodeDrainController(h.informers, opts.NodeName, h.Server, *opts.Drain)
+	}
+
+	return h
+}
+
+// Start starts the informers and controllers and waits until the objects
+// already in the cluster were reconciled.
+func (h *Harness) Start() error {
+	h.informers.Start(h.stopCh)
+	if !cache.WaitForCacheSync(h.stopCh, h.informers.synced) {
+		return fmt.Errorf("Oops. Something went wrong. Informers didn't sync")
+	}
+
+	reconciled := []<-chan struct{}{h.externalServices.Reconciled()}
+	go h.externalServices.Run(h.stopCh, &h.wg)
+	if h.PodSubnet {
+		reconciled = append(reconciled, h.podSubnets.Reconciled())
+		go h.podSubnets.Run(h.stopCh, &h.wg)
+	}
+	if h.drain != nil {
+		reconciled = append(reconciled, h.drain.Reconciled())
+		go h.drain.Run(h.stopCh, &h.wg)
+	}
+
+	timeout := time.After(settleTimeout)
+	for _, ch := range reconciled {
+		select {
+		case <-ch:
+		case <-timeout:
+			return fmt.Errorf("Oops. Something went wrong. Initial reconcile didn't finish within %s", settleTimeout)
+		}
+	}
+	return h.Settle()
+}
+
+// Stop stops the controllers and informers.
+func (h *Harness) Stop() {
+	close(h.stopCh)
+	h.wg.Wait()
+}
+
+// Settle waits until the informers saw all changes to the cluster and the
+// controllers stopped changing announcements.
+func (h *Harness) Settle() error {
+	deadline := time.Now().Add(settleTimeout)
+	for !h.informers.synced() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Oops. Something went wrong. Informers didn't catch up within %s", settleTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	calls, quietSince := len(h.Speaker.Calls()), time.Now()
+	for time.Since(quietSince) < settleQuiet {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Oops. Something went wrong. Announcements didn't settle within %s", settleTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if n := len(h.Speaker.Calls()); n != calls {
+			calls, quietSince = n, time.Now()
+		}
+	}
+	return nil
+}
+
+// Announced returns the announced routes as "prefix -> next hop", ordered by
+// prefix.
+func (h *Harness) Announced() []string {
+	return h.Speaker.Announced()
+}
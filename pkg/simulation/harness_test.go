@@ -0,0 +1,432 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package simulation
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sapcc/kube-parrot/pkg/bgp"
+	"github.com/sapcc/kube-parrot/pkg/controller"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	testNode             = "node-a"
+	testOtherNode        = "node-b"
+	testClass            = "parrot"
+	testDrainTime        = time.Second
+	testHoldDown         = 2 * time.Second
+	testHostIP           = "10.0.0.1"
+	testAnnouncedIP      = "1.2.3.4/32 -> " + testHostIP
+	testAnnouncedOtherIP = "1.2.3.5/32 -> " + testHostIP
+	testPodCIDR          = "10.2.0.0/24"
+	testAnnouncedPodCIDR = testPodCIDR + " -> " + testHostIP
+	testHostIPv6         = "2001:db8::1"
+	testPodCIDRv6        = "fd00:2::/64"
+)
+
+// step changes the cluster, waits for the controllers to settle and checks
+// what is announced.
+type step struct {
+	name   string
+	apply  []runtime.Object
+	delete []runtime.Object
+	// wait is slept before settling, e.g. for the drain time to pass.
+	wait time.Duration
+
+	announced []string
+	// services are the services the announced routes belong to, if set.
+	// Services claiming the same prefix need different path attributes to
+	// tell them apart, as a new owner isn't announced otherwise.
+	services    []string
+	depreferred bool
+	conflicts   int
+	// pending are the held down announcements and withdrawals, cancelled
+	// the transitions reverted so far.
+	pending   [2]int
+	cancelled uint64
+}
+
+func TestHarness(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		objects []runtime.Object
+		steps   []step
+	}{
+		{
+			name:    "externalTrafficPolicy flips between Local and Cluster",
+			objects: []runtime.Object{node(testNode), service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeLocal, "1.2.3.4"), endpoints("a", testOtherNode)},
+			steps: []step{
+				{name: "Local without local endpoints"},
+				{
+					name:      "Cluster",
+					apply:     []runtime.Object{service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeCluster, "1.2.3.4")},
+					announced: []string{testAnnouncedIP},
+				},
+				{
+					name:  "Local again",
+					apply: []runtime.Object{service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeLocal, "1.2.3.4")},
+				},
+			},
+		},
+		{
+			name:    "endpoints move between nodes",
+			objects: []runtime.Object{node(testNode), service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeLocal, "1.2.3.4"), endpoints("a", testNode)},
+			steps: []step{
+				{name: "local endpoint", announced: []string{testAnnouncedIP}},
+				{name: "moved away", apply: []runtime.Object{endpoints("a", testOtherNode)}},
+				{name: "moved back", apply: []runtime.Object{endpoints("a", testOtherNode, testNode)}, announced: []string{testAnnouncedIP}},
+				{name: "deleted", delete: []runtime.Object{endpoints("a")}},
+			},
+		},
+		{
+			name:    "external IP is removed",
+			objects: []runtime.Object{node(testNode), service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeCluster, "1.2.3.4", "1.2.3.5"), endpoints("a", testOtherNode)},
+			steps: []step{
+				{name: "both IPs", announced: []string{testAnnouncedIP, testAnnouncedOtherIP}},
+				{
+					name:      "one removed",
+					apply:     []runtime.Object{service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeCluster, "1.2.3.5")},
+					announced: []string{testAnnouncedOtherIP},
+				},
+				{name: "service deleted", delete: []runtime.Object{service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeCluster)}},
+			},
+		},
+		{
+			name: "node is drained",
+			options: Options{Drain: &controller.DrainOptions{
+				Depreference: bgp.Depreference{Mode: bgp.DepreferCommunity},
+				Time:         testDrainTime,
+			}},
+			objects: []runtime.Object{node(testNode), service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeCluster, "1.2.3.4"), endpoints("a", testOtherNode)},
+			steps: []step{
+				{name: "not draining", announced: []string{testAnnouncedIP}},
+				{
+					name:        "draining",
+					apply:       []runtime.Object{node(testNode, controller.AnnotationDrain, "true")},
+					announced:   []string{testAnnouncedIP},
+					depreferred: true,
+				},
+				{name: "drained", wait: testDrainTime},
+				{name: "back in service", apply: []runtime.Object{node(testNode)}, announced: []string{testAnnouncedIP}},
+			},
+		},
+		{
+			name: "pod subnet stays announced while the node is drained",
+			options: Options{PodSubnet: true, Drain: &controller.DrainOptions{
+				Depreference: bgp.Depreference{Mode: bgp.DepreferCommunity},
+				Time:         testDrainTime,
+			}},
+			objects: []runtime.Object{withPodCIDRs(node(testNode), testPodCIDR), service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeCluster, "1.2.3.4"), endpoints("a", testOtherNode)},
+			steps: []step{
+				{name: "not draining", announced: []string{testAnnouncedIP, testAnnouncedPodCIDR}},
+				{
+					name:        "draining",
+					apply:       []runtime.Object{withPodCIDRs(node(testNode, controller.AnnotationDrain, "true"), testPodCIDR)},
+					announced:   []string{testAnnouncedIP, testAnnouncedPodCIDR},
+					depreferred: true,
+				},
+				{name: "drained", wait: testDrainTime, announced: []string{testAnnouncedPodCIDR}},
+				{name: "cordoned", apply: []runtime.Object{cordoned(withPodCIDRs(node(testNode), testPodCIDR))}, announced: []string{testAnnouncedPodCIDR}},
+			},
+		},
+		{
+			name:    "hold-down",
+			options: Options{HoldDown: bgp.HoldDown{AnnounceDelay: testHoldDown, WithdrawDelay: testHoldDown}},
+			objects: []runtime.Object{node(testNode), service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeCluster, "1.2.3.4"), endpoints("a", testOtherNode)},
+			steps: []step{
+				{name: "announcement held down", pending: [2]int{1, 0}},
+				{name: "announced after AnnounceDelay", wait: testHoldDown, announced: []string{testAnnouncedIP}},
+				{name: "endpoints gone", delete: []runtime.Object{endpoints("a")}, announced: []string{testAnnouncedIP}, pending: [2]int{0, 1}},
+				{name: "endpoints back within WithdrawDelay", apply: []runtime.Object{endpoints("a", testOtherNode)}, announced: []string{testAnnouncedIP}, cancelled: 1},
+				{name: "not withdrawn after the flap", wait: testHoldDown, announced: []string{testAnnouncedIP}, cancelled: 1},
+				{name: "endpoints gone again", delete: []runtime.Object{endpoints("a")}, announced: []string{testAnnouncedIP}, pending: [2]int{0, 1}, cancelled: 1},
+				{name: "withdrawn after WithdrawDelay", wait: testHoldDown, cancelled: 1},
+				{name: "endpoints back", apply: []runtime.Object{endpoints("a", testOtherNode)}, pending: [2]int{1, 0}, cancelled: 1},
+				{name: "announced again", wait: testHoldDown, announced: []string{testAnnouncedIP}, cancelled: 1},
+				{name: "service deleted", delete: []runtime.Object{service("a", time.Unix(0, 0), v1.ServiceExternalTrafficPolicyTypeCluster)}, cancelled: 1},
+			},
+		},
+		{
+			name:    "pod CIDRs are added and changed",
+			options: Options{PodSubnet: true},
+			objects: []runtime.Object{node(testNode)},
+			steps: []step{
+				{name: "no pod CIDR"},
+				{name: "added", apply: []runtime.Object{withPodCIDRs(node(testNode), testPodCIDR)}, announced: []string{testAnnouncedPodCIDR}},
+				{name: "changed", apply: []runtime.Object{withPodCIDRs(node(testNode), "10.2.1.0/24")}, announced: []string{"10.2.1.0/24 -> " + testHostIP}},
+				{name: "removed", apply: []runtime.Object{node(testNode)}},
+				{name: "other node", apply: []runtime.Object{withPodCIDRs(withInternalIPs(node(testOtherNode), "10.0.0.2"), testPodCIDR)}},
+			},
+		},
+		{
+			name:    "dual-stack pod CIDRs",
+			options: Options{PodSubnet: true},
+			objects: []runtime.Object{withPodCIDRs(withInternalIPs(node(testNode), testHostIPv6, testHostIP), testPodCIDR, testPodCIDRv6)},
+			steps: []step{
+				{name: "both families", announced: []string{testAnnouncedPodCIDR, testPodCIDRv6 + " -> " + testHostIPv6}},
+				{
+					name:      "no IPv6 InternalIP",
+					apply:     []runtime.Object{withPodCIDRs(node(testNode), testPodCIDR, testPodCIDRv6)},
+					announced: []string{testAnnouncedPodCIDR},
+				},
+				{name: "node deleted", delete: []runtime.Object{node(testNode)}},
+			},
+		},
+		{
+			name:    "services conflict",
+			options: Options{LoadBalancerClass: testClass},
+			objects: []runtime.Object{
+				node(testNode),
+				withAnnotation(service("a", time.Unix(100, 0), v1.ServiceExternalTrafficPolicyTypeCluster, "1.2.3.4"), bgp.AnnotationMED, "10"), endpoints("a", testOtherNode),
+				withAnnotation(loadBalancer("b", time.Unix(200, 0), "1.2.3.4"), bgp.AnnotationMED, "20"), endpoints("b", testOtherNode),
+			},
+			steps: []step{
+				{name: "older service wins", announced: []string{testAnnouncedIP}, services: []string{"a"}, conflicts: 1},
+				{
+					name:      "winner loses its external IP",
+					apply:     []runtime.Object{service("a", time.Unix(100, 0), v1.ServiceExternalTrafficPolicyTypeCluster)},
+					announced: []string{testAnnouncedIP},
+					services:  []string{"b"},
+				},
+				{
+					name:      "priority takes precedence over age",
+					apply:     []runtime.Object{withAnnotation(withAnnotation(service("c", time.Unix(300, 0), v1.ServiceExternalTrafficPolicyTypeCluster, "1.2.3.4"), bgp.AnnotationPriority, "10"), bgp.AnnotationMED, "30"), endpoints("c", testOtherNode)},
+					announced: []string{testAnnouncedIP},
+					services:  []string{"c"},
+					conflicts: 1,
+				},
+				{
+					name:      "winner is deleted",
+					delete:    []runtime.Object{service("c", time.Unix(300, 0), v1.ServiceExternalTrafficPolicyTypeCluster)},
+					announced: []string{testAnnouncedIP},
+					services:  []string{"b"},
+				},
+				{name: "last claim is deleted", delete: []runtime.Object{loadBalancer("b", time.Unix(200, 0))}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.options
+			opts.As, opts.RemoteAs = 65000, 65000
+			opts.NodeName = testNode
+			opts.HostIP = net.ParseIP(testHostIP)
+			opts.AssumeHealthy = true
+
+			h := New(opts)
+			if err := h.Apply(tt.objects...); err != nil {
+				t.Fatal(err)
+			}
+			if err := h.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer h.Stop()
+
+			for _, s := range tt.steps {
+				if err := h.Apply(s.apply...); err != nil {
+					t.Fatal(err)
+				}
+				if err := h.Delete(s.delete...); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(s.wait)
+				if err := h.Settle(); err != nil {
+					t.Fatal(err)
+				}
+
+				if got := h.Announced(); !reflect.DeepEqual(got, s.announced) {
+					t.Errorf("%s: announced %v, expected %v", s.name, got, s.announced)
+				}
+				routes := h.Speaker.Routes()
+				if s.services != nil {
+					var services []string
+					for _, route := range routes {
+						if svc := bgp.RouteService(route.RouteInterface); svc != nil {
+							services = append(services, svc.Name)
+						}
+					}
+					if !reflect.DeepEqual(services, s.services) {
+						t.Errorf("%s: announced for services %v, expected %v", s.name, services, s.services)
+					}
+				}
+				for _, route := range routes {
+					// Pod subnets are never depreferred by draining.
+					if bgp.RouteService(route.RouteInterface) == nil {
+						if route.Depreference.Mode != "" {
+							t.Errorf("%s: %s is depreferred", s.name, route)
+						}
+						continue
+					}
+					if depreferred := route.Depreference.Mode != ""; depreferred != s.depreferred {
+						t.Errorf("%s: %s is depreferred: %t, expected %t", s.name, route, depreferred, s.depreferred)
+					}
+				}
+				if conflicts := h.Server.Conflicts(); conflicts != s.conflicts {
+					t.Errorf("%s: %d conflicts, expected %d", s.name, conflicts, s.conflicts)
+				}
+				if announcements, withdrawals := h.Server.PendingTransitions(); [2]int{announcements, withdrawals} != s.pending {
+					t.Errorf("%s: %d announcements and %d withdrawals pending, expected %v", s.name, announcements, withdrawals, s.pending)
+				}
+				if cancelled := h.Server.CancelledTransitions(); cancelled != s.cancelled {
+					t.Errorf("%s: %d transitions cancelled, expected %d", s.name, cancelled, s.cancelled)
+				}
+			}
+		})
+	}
+}
+
+func TestClusterTrimsEvents(t *testing.T) {
+	c := NewCluster()
+	for i := 0; i < eventHistory+10; i++ {
+		if err := c.Apply(node(testNode)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lw := c.ListWatch(&v1.Node{})
+	if _, err := lw.Watch(metav1.ListOptions{ResourceVersion: "1"}); err == nil {
+		t.Error("expected watching from a trimmed resource version to fail")
+	}
+	w, err := lw.Watch(metav1.ListOptions{ResourceVersion: "20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	if n := len(w.(*watcher).events); n != eventHistory+10-20 {
+		t.Errorf("expected %d events since resource version 20, got %d", eventHistory+10-20, n)
+	}
+}
+
+func TestClusterDeliversWithoutBlockingLists(t *testing.T) {
+	c := NewCluster()
+	lw := c.ListWatch(&v1.Node{})
+	w, err := lw.Watch(metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nobody reads from the watcher, so changes block once its buffer is
+	// full. Listing must still work meanwhile.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < watchBuffer+10; i++ {
+			c.Apply(node(testNode))
+		}
+	}()
+
+	listed := make(chan error)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, err := lw.List(metav1.ListOptions{})
+		listed <- err
+	}()
+	select {
+	case err := <-listed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("listing blocked while a watcher was full")
+	}
+
+	w.Stop()
+	<-done
+}
+
+func node(name string, annotations ...string) *v1.Node {
+	n := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{}},
+		Status:     v1.NodeStatus{Addresses: []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: testHostIP}}},
+	}
+	for i := 0; i+1 < len(annotations); i += 2 {
+		n.Annotations[annotations[i]] = annotations[i+1]
+	}
+	return n
+}
+
+func withPodCIDRs(n *v1.Node, cidrs ...string) *v1.Node {
+	n.Spec.PodCIDRs = cidrs
+	if len(cidrs) > 0 {
+		n.Spec.PodCIDR = cidrs[0]
+	}
+	return n
+}
+
+// withInternalIPs replaces the InternalIPs of a node.
+func withInternalIPs(n *v1.Node, ips ...string) *v1.Node {
+	n.Status.Addresses = nil
+	for _, ip := range ips {
+		n.Status.Addresses = append(n.Status.Addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: ip})
+	}
+	return n
+}
+
+func cordoned(n *v1.Node) *v1.Node {
+	n.Spec.Unschedulable = true
+	return n
+}
+
+func service(name string, created time.Time, policy v1.ServiceExternalTrafficPolicyType, externalIPs ...string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, CreationTimestamp: metav1.NewTime(created)},
+		Spec: v1.ServiceSpec{
+			Type:                  v1.ServiceTypeClusterIP,
+			ExternalIPs:           externalIPs,
+			ExternalTrafficPolicy: policy,
+			Ports:                 []v1.ServicePort{{Port: 80}},
+		},
+	}
+}
+
+func loadBalancer(name string, created time.Time, ingressIPs ...string) *v1.Service {
+	svc := service(name, created, v1.ServiceExternalTrafficPolicyTypeCluster)
+	svc.Spec.Type = v1.ServiceTypeLoadBalancer
+	class := testClass
+	svc.Spec.LoadBalancerClass = &class
+	for _, ip := range ingressIPs {
+		svc.Status.LoadBalancer.Ingress = append(svc.Status.LoadBalancer.Ingress, v1.LoadBalancerIngress{IP: ip})
+	}
+	return svc
+}
+
+func withAnnotation(svc *v1.Service, key, value string) *v1.Service {
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+	svc.Annotations[key] = value
+	return svc
+}
+
+// endpoints returns the EndpointSlice of a service with a ready endpoint on
+// each of the given nodes.
+func endpoints(service string, nodes ...string) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      service + "-slice",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+	}
+	ready := true
+	for i, nodeName := range nodes {
+		nodeName := nodeName
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{net.IPv4(10, 1, 0, byte(i+1)).String()},
+			NodeName:   &nodeName,
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		})
+	}
+	return slice
+}
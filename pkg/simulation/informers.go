@@ -0,0 +1,136 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package simulation
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/sapcc/kube-parrot/pkg/forked/informer"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// informerFactory provides the informers the controllers expect, listing
+// and watching a Cluster instead of the API.
+type informerFactory struct {
+	cluster *Cluster
+
+	lock             sync.Mutex
+	informers        map[reflect.Type]cache.SharedIndexInformer
+	startedInformers map[reflect.Type]bool
+}
+
+var _ informer.SharedInformerFactory = &informerFactory{}
+
+func newInformerFactory(cluster *Cluster) *informerFactory {
+	return &informerFactory{
+		cluster:          cluster,
+		informers:        map[reflect.Type]cache.SharedIndexInformer{},
+		startedInformers: map[reflect.Type]bool{},
+	}
+}
+
+func (f *informerFactory) Start(stopCh <-chan struct{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for informerType, informer := range f.informers {
+		if !f.startedInformers[informerType] {
+			go informer.Run(stopCh)
+			f.startedInformers[informerType] = true
+		}
+	}
+}
+
+// synced checks whether all informers have seen the latest change of the
+// cluster.
+func (f *informerFactory) synced() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for informerType, informer := range f.informers {
+		obj := reflect.New(informerType.Elem()).Interface().(runtime.Object)
+		if !informer.HasSynced() || informer.LastSyncResourceVersion() != f.cluster.ResourceVersion(obj) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *informerFactory) informer(obj runtime.Object, indexers cache.Indexers) cache.SharedIndexInformer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	informerType := reflect.TypeOf(obj)
+	if informer, exists := f.informers[informerType]; exists {
+		return informer
+	}
+	informer := cache.NewSharedIndexInformer(f.cluster.ListWatch(obj), obj, 0, indexers)
+	f.informers[informerType] = informer
+	return informer
+}
+
+var namespaceIndexers = cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+
+func (f *informerFactory) Services() informer.ServiceInformer {
+	return &serviceInformer{f.informer(&v1.Service{}, namespaceIndexers)}
+}
+
+func (f *informerFactory) Nodes() informer.NodeInformer {
+	return &nodeInformer{f.informer(&v1.Node{}, cache.Indexers{})}
+}
+
+func (f *informerFactory) EndpointSlices() informer.EndpointSliceInformer {
+	return &endpointSliceInformer{f.informer(&discoveryv1.EndpointSlice{}, cache.Indexers{
+		cache.NamespaceIndex:               cache.MetaNamespaceIndexFunc,
+		informer.EndpointSliceServiceIndex: informer.EndpointSliceServiceIndexFunc,
+	})}
+}
+
+func (f *informerFactory) Pods() informer.PodInformer {
+	return &podInformer{f.informer(&v1.Pod{}, namespaceIndexers)}
+}
+
+func (f *informerFactory) Namespaces() informer.NamespaceInformer {
+	return &namespaceInformer{f.informer(&v1.Namespace{}, cache.Indexers{})}
+}
+
+type serviceInformer struct{ cache.SharedIndexInformer }
+
+func (i *serviceInformer) Informer() cache.SharedIndexInformer { return i.SharedIndexInformer }
+func (i *serviceInformer) Lister() *informer.StoreToServiceLister {
+	return &informer.StoreToServiceLister{Indexer: i.GetIndexer()}
+}
+
+type nodeInformer struct{ cache.SharedIndexInformer }
+
+func (i *nodeInformer) Informer() cache.SharedIndexInformer { return i.SharedIndexInformer }
+func (i *nodeInformer) Lister() *informer.StoreToNodeLister {
+	return &informer.StoreToNodeLister{Store: i.GetStore()}
+}
+
+type endpointSliceInformer struct{ cache.SharedIndexInformer }
+
+func (i *endpointSliceInformer) Informer() cache.SharedIndexInformer { return i.SharedIndexInformer }
+func (i *endpointSliceInformer) Lister() *informer.StoreToEndpointSliceLister {
+	return &informer.StoreToEndpointSliceLister{Indexer: i.GetIndexer()}
+}
+
+type podInformer struct{ cache.SharedIndexInformer }
+
+func (i *podInformer) Informer() cache.SharedIndexInformer { return i.SharedIndexInformer }
+func (i *podInformer) Lister() *informer.StoreToPodLister {
+	return &informer.StoreToPodLister{Indexer: i.GetIndexer()}
+}
+
+type namespaceInformer struct{ cache.SharedIndexInformer }
+
+func (i *namespaceInformer) Informer() cache.SharedIndexInformer { return i.SharedIndexInformer }
+func (i *namespaceInformer) Lister() *informer.StoreToNamespaceLister {
+	return &informer.StoreToNamespaceLister{Store: i.GetStore()}
+}
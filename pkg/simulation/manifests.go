@@ -0,0 +1,119 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// ReadManifests decodes the objects of a YAML or JSON stream, like the
+// output of kubectl get -o yaml. Documents may be single objects or lists.
+func ReadManifests(r io.Reader) ([]runtime.Object, error) {
+	var objs []runtime.Object
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var raw runtime.RawExtension
+		if err := decoder.Decode(&raw); err == io.EOF {
+			return objs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("couldn't parse manifest: %s", err)
+		}
+		if len(bytes.TrimSpace(raw.Raw)) == 0 || bytes.Equal(bytes.TrimSpace(raw.Raw), []byte("null")) {
+			continue
+		}
+
+		decoded, err := decodeManifest(raw.Raw)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, decoded...)
+	}
+}
+
+func decodeManifest(data []byte) ([]runtime.Object, error) {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode manifest: %s", err)
+	}
+
+	list, ok := obj.(*v1.List)
+	if !ok {
+		return []runtime.Object{obj}, nil
+	}
+
+	var objs []runtime.Object
+	for _, item := range list.Items {
+		decoded, err := decodeManifest(item.Raw)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, decoded...)
+	}
+	return objs, nil
+}
+
+// MirrorEndpoints converts Endpoints to EndpointSlices, which the
+// controllers watch, like the EndpointSlice mirroring controller does.
+// Endpoints of services that have EndpointSlices of their own are dropped.
+// Other objects are passed through.
+func MirrorEndpoints(objs []runtime.Object) []runtime.Object {
+	sliced := map[string]bool{}
+	for _, obj := range objs {
+		if slice, ok := obj.(*discoveryv1.EndpointSlice); ok {
+			sliced[slice.Namespace+"/"+slice.Labels[discoveryv1.LabelServiceName]] = true
+		}
+	}
+
+	var mirrored []runtime.Object
+	for _, obj := range objs {
+		endpoints, ok := obj.(*v1.Endpoints)
+		if !ok {
+			mirrored = append(mirrored, obj)
+			continue
+		}
+		if sliced[endpoints.Namespace+"/"+endpoints.Name] {
+			continue
+		}
+		mirrored = append(mirrored, endpointSlice(endpoints))
+	}
+	return mirrored
+}
+
+func endpointSlice(endpoints *v1.Endpoints) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: endpoints.Namespace,
+			Name:      endpoints.Name + "-mirrored",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: endpoints.Name},
+		},
+	}
+
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			slice.Endpoints = append(slice.Endpoints, mirroredEndpoint(address, true))
+		}
+		for _, address := range subset.NotReadyAddresses {
+			slice.Endpoints = append(slice.Endpoints, mirroredEndpoint(address, false))
+		}
+	}
+	return slice
+}
+
+func mirroredEndpoint(address v1.EndpointAddress, ready bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  []string{address.IP},
+		NodeName:   address.NodeName,
+		Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+	}
+}
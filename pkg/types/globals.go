@@ -6,4 +6,11 @@ package types
 const (
 	KubeProxyNamespace = "kube-system"
 	KubeProxyPrefix    = "kube-proxy"
+	// KubeProxyHealthzPort is kube-proxy's default --healthz-bind-address port.
+	KubeProxyHealthzPort = 10256
+
+	LeaseNamespace = "kube-system"
+	IPAMLeaseName  = "kube-parrot-ipam"
+
+	SecretNamespace = "kube-system"
 )
@@ -0,0 +1,152 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+
+	utiljson "encoding/json"
+
+	"github.com/golang/glog"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	ConfigPath = "/etc/kubernetes/kube-parrot/config"
+
+	PodCIDRSourceConfig     = "config"
+	PodCIDRSourceAnnotation = "annotation"
+	PodCIDRSourceSpec       = "spec"
+)
+
+// DefaultPodCIDRSources prefers the explicitly configured pod CIDRs over the
+// ones assigned by kube-controller-manager's IPAM.
+var DefaultPodCIDRSources = []string{PodCIDRSourceConfig, PodCIDRSourceAnnotation, PodCIDRSourceSpec}
+
+// ErrNoConfig is returned by LoadConfig if there is no config file. Parrot
+// runs without one, but any other error loading it is fatal, as an empty
+// config would allow announcing all prefixes.
+var ErrNoConfig = errors.New("no config file found")
+
+var (
+	// configMu guards config, which controllers read concurrently.
+	configMu sync.Mutex
+	config   *Config
+)
+
+type Config struct {
+	PodCIDR        string        `json:"podCIDR"`
+	PodCIDRSources []string      `json:"podCIDRSources"`
+	AddressPools   []AddressPool `json:"addressPools"`
+	Communities    Communities   `json:"communities"`
+	Neighbors      []Neighbor    `json:"neighbors"`
+
+	AllowedPrefixes []AllowedPrefixes `json:"allowedPrefixes"`
+}
+
+// AllowedPrefixes are CIDRs that service IPs may be announced from. If
+// Namespaces is set, they are only allowed for services in these namespaces.
+type AllowedPrefixes struct {
+	Prefixes   []string `json:"prefixes"`
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// Communities are BGP communities in their textual representation.
+type Communities struct {
+	Standard []string `json:"standard,omitempty"`
+	Extended []string `json:"extended,omitempty"`
+	Large    []string `json:"large,omitempty"`
+}
+
+// AddressPool configures addresses that LoadBalancer IPs are allocated from.
+// Addresses are CIDRs or ranges of the form first-last. If Namespaces is set,
+// the pool is restricted to services in these namespaces.
+type AddressPool struct {
+	Name       string   `json:"name"`
+	Addresses  []string `json:"addresses"`
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// GetConfig returns the parrot config, loading it from ConfigPath on first
+// use unless LoadConfig was called before.
+func GetConfig() *Config {
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	if config == nil {
+		c, err := loadConfig(ConfigPath)
+		if err != nil {
+			glog.Errorf("Couldn't read config file: %s", err)
+		}
+		config = c
+	}
+	return config
+}
+
+// LoadConfig loads the parrot config from path and validates it. The config
+// is used by subsequent calls to GetConfig, even if it is invalid.
+func LoadConfig(path string) (*Config, error) {
+	c, err := loadConfig(path)
+	configMu.Lock()
+	config = c
+	configMu.Unlock()
+	if err != nil {
+		return c, err
+	}
+	return c, c.validate()
+}
+
+// GetPodCIDRSources returns the order in which node pod CIDR sources are tried.
+func (c *Config) GetPodCIDRSources() []string {
+	if len(c.PodCIDRSources) == 0 {
+		return DefaultPodCIDRSources
+	}
+	return c.PodCIDRSources
+}
+
+func (c *Config) validate() error {
+	for _, n := range c.Neighbors {
+		if err := n.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, a := range c.AllowedPrefixes {
+		for _, prefix := range a.Prefixes {
+			if _, _, err := net.ParseCIDR(prefix); err != nil {
+				return fmt.Errorf("invalid allowed prefix %q: %s", prefix, err)
+			}
+		}
+	}
+	return nil
+}
+
+func loadConfig(path string) (*Config, error) {
+	c := &Config{}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return c, fmt.Errorf("%w at %q", ErrNoConfig, path)
+	}
+	glog.V(2).Infof("config file found at %q", path)
+
+	yaml, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, fmt.Errorf("couldn't read config file %q: %s", path, err)
+	}
+
+	json, err := utilyaml.ToJSON(yaml)
+	if err != nil {
+		return c, fmt.Errorf("couldn't parse config file %q: %s", path, err)
+	}
+
+	if err = utiljson.Unmarshal(json, c); err != nil {
+		return c, fmt.Errorf("couldn't unmarshal config file %q: %s", path, err)
+	}
+
+	return c, nil
+}
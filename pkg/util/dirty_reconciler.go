@@ -18,10 +18,17 @@ func NewNamedDirtyReconciler(name string, reconcileFunc func() error) DirtyRecon
 	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), name)
 
 	return &dirtyReconciler{
-		Type{queue, reconcileFunc},
+		Type{queue: queue, reconcile: reconcileFunc, reconciled: make(chan struct{})},
 	}
 }
 
+// Run reconciles once right away, even if nothing was marked dirty yet, so
+// an empty cluster counts as reconciled, too.
+func (c *dirtyReconciler) Run(stopCh <-chan struct{}) {
+	c.Dirty()
+	c.Type.Run(stopCh)
+}
+
 func (c *dirtyReconciler) Dirty() {
 	c.queue.AddRateLimited("dirty")
 }
@@ -0,0 +1,95 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package util
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// LeaderElector makes sure that only one parrot in the cluster acts as
+// leader, by holding a coordination.k8s.io Lease.
+type LeaderElector struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	identity  string
+	leading   atomic.Bool
+
+	onStartedLeading func()
+}
+
+func NewLeaderElector(client kubernetes.Interface, namespace, name, identity string, onStartedLeading func()) *LeaderElector {
+	return &LeaderElector{
+		client:           client,
+		namespace:        namespace,
+		name:             name,
+		identity:         identity,
+		onStartedLeading: onStartedLeading,
+	}
+}
+
+// IsLeader returns whether this instance currently holds the lease.
+func (l *LeaderElector) IsLeader() bool {
+	return l.leading.Load()
+}
+
+// Run competes for the lease until stopCh is closed. The lease is released
+// on stop, so another instance can take over right away.
+func (l *LeaderElector) Run(stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: l.namespace, Name: l.name},
+			Client:     l.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: l.identity},
+		},
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            l.name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				glog.Infof("Acquired lease %s/%s. Became leader", l.namespace, l.name)
+				l.leading.Store(true)
+				if l.onStartedLeading != nil {
+					l.onStartedLeading()
+				}
+			},
+			OnStoppedLeading: func() {
+				if l.leading.Swap(false) {
+					glog.Infof("Lost lease %s/%s", l.namespace, l.name)
+				}
+			},
+		},
+	})
+	if err != nil {
+		glog.Errorf("Oops. Something went wrong electing a leader for lease %s/%s: %s", l.namespace, l.name, err)
+		return
+	}
+
+	// Run returns once the lease is lost. Keep competing for it.
+	wait.UntilWithContext(ctx, elector.Run, retryPeriod)
+}
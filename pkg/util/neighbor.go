@@ -0,0 +1,104 @@
+// Copyright 2025 SAP SE
+// SPDX-License-Identifier: Apache-2.0
+
+package util
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/sapcc/kube-parrot/pkg/types"
+)
+
+const (
+	FamilyIPv4Unicast = "ipv4-unicast"
+	FamilyIPv6Unicast = "ipv6-unicast"
+)
+
+// DefaultFamilies are negotiated with neighbors that don't configure any.
+var DefaultFamilies = []string{FamilyIPv4Unicast, FamilyIPv6Unicast}
+
+// Neighbor configures a BGP neighbor. Timers are given in seconds. Unset
+// values fall back to the command line flags or GoBGP's defaults.
+type Neighbor struct {
+	Address           string   `json:"address"`
+	RemoteAS          uint32   `json:"remoteAS,omitempty"`
+	Description       string   `json:"description,omitempty"`
+	HoldTime          uint32   `json:"holdTime,omitempty"`
+	KeepaliveInterval uint32   `json:"keepaliveInterval,omitempty"`
+	EBGPMultihopTTL   uint8    `json:"ebgpMultihopTTL,omitempty"`
+	LocalAddress      string   `json:"localAddress,omitempty"`
+	Passive           bool     `json:"passive,omitempty"`
+	Families          []string `json:"families,omitempty"`
+
+	Password *NeighborPassword `json:"password,omitempty"`
+}
+
+// NeighborPassword references the TCP MD5 password of a neighbor. It is read
+// either from a key of a Secret or from a file, e.g. a mounted Secret volume.
+// TCP-AO isn't supported by GoBGP, so MD5 is the only option.
+type NeighborPassword struct {
+	SecretName      string `json:"secretName,omitempty"`
+	SecretNamespace string `json:"secretNamespace,omitempty"`
+	Key             string `json:"key,omitempty"`
+	File            string `json:"file,omitempty"`
+}
+
+// NewNeighbor returns a neighbor with default settings.
+func NewNeighbor(address net.IP) Neighbor {
+	return Neighbor{Address: address.String()}
+}
+
+// IP returns the parsed address of the neighbor.
+func (n Neighbor) IP() net.IP {
+	return net.ParseIP(n.Address)
+}
+
+// GetFamilies returns the address families to negotiate with the neighbor.
+func (n Neighbor) GetFamilies() []string {
+	if len(n.Families) == 0 {
+		return DefaultFamilies
+	}
+	return n.Families
+}
+
+// GetSecretNamespace returns the namespace of the referenced Secret.
+func (p *NeighborPassword) GetSecretNamespace() string {
+	if p.SecretNamespace == "" {
+		return types.SecretNamespace
+	}
+	return p.SecretNamespace
+}
+
+func (p *NeighborPassword) Validate() error {
+	if (p.SecretName == "") == (p.File == "") {
+		return fmt.Errorf("password needs either a secretName or a file")
+	}
+	if p.SecretName != "" && p.Key == "" {
+		return fmt.Errorf("password secret %s needs a key", p.SecretName)
+	}
+	return nil
+}
+
+func (n Neighbor) Validate() error {
+	if n.IP() == nil {
+		return fmt.Errorf("neighbor address %q is not a valid IP address", n.Address)
+	}
+	if n.LocalAddress != "" && net.ParseIP(n.LocalAddress) == nil {
+		return fmt.Errorf("local address %q of neighbor %s is not a valid IP address", n.LocalAddress, n.Address)
+	}
+	if n.KeepaliveInterval != 0 && n.HoldTime != 0 && n.KeepaliveInterval >= n.HoldTime {
+		return fmt.Errorf("keepalive interval of neighbor %s must be lower than its hold time", n.Address)
+	}
+	for _, family := range n.Families {
+		if family != FamilyIPv4Unicast && family != FamilyIPv6Unicast {
+			return fmt.Errorf("unsupported address family %q for neighbor %s", family, n.Address)
+		}
+	}
+	if n.Password != nil {
+		if err := n.Password.Validate(); err != nil {
+			return fmt.Errorf("neighbor %s: %s", n.Address, err)
+		}
+	}
+	return nil
+}
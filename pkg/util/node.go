@@ -5,27 +5,16 @@ package util
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
+	"net"
+	"strings"
 
-	utiljson "encoding/json"
-
-	"github.com/golang/glog"
 	v1 "k8s.io/api/core/v1"
-	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 )
 
 const (
 	AnnotationNodePodSubnet = "parrot.sap.cc/podsubnet"
-	ConfigPath              = "/etc/kubernetes/kube-parrot/config"
 )
 
-var config *Config
-
-type Config struct {
-	PodCIDR string `json:"podCIDR"`
-}
-
 func GetNodeInternalIP(node *v1.Node) (string, error) {
 	for _, address := range node.Status.Addresses {
 		if address.Type == v1.NodeInternalIP {
@@ -36,47 +25,55 @@ func GetNodeInternalIP(node *v1.Node) (string, error) {
 	return "", fmt.Errorf("Node must have an InternalIP: %s", node.Name)
 }
 
-func GetNodePodSubnet(node *v1.Node) (string, error) {
-	if config == nil {
-		c, err := loadConfig()
-		if err != nil {
-			glog.Errorf("Couldn't read config file: %s", err)
+// GetNodeInternalIPOfFamily returns the first InternalIP of the node that
+// is an IPv6 address if ipv6 is set, or an IPv4 address otherwise.
+func GetNodeInternalIPOfFamily(node *v1.Node, ipv6 bool) (string, error) {
+	for _, address := range node.Status.Addresses {
+		if address.Type != v1.NodeInternalIP {
+			continue
+		}
+		ip := net.ParseIP(address.Address)
+		if ip != nil && (ip.To4() == nil) == ipv6 {
+			return address.Address, nil
 		}
-		config = c
-	}
-
-	if config.PodCIDR != "" {
-		return config.PodCIDR, nil
-	}
-
-	if l, ok := node.Annotations[AnnotationNodePodSubnet]; ok {
-		return l, nil
 	}
 
-	return "", fmt.Errorf("Couldn't figure out nodes PodCIDR. Set annotation or configfile.")
+	return "", fmt.Errorf("Node must have an InternalIP of the requested family (ipv6=%v): %s", ipv6, node.Name)
 }
 
-func loadConfig() (*Config, error) {
-	c := &Config{}
-
-	if _, err := os.Stat(ConfigPath); os.IsNotExist(err) {
-		return c, fmt.Errorf("to advertise node pod subnet, provide config at %q", ConfigPath)
-	}
-	glog.V(2).Infof("config file found at %q", ConfigPath)
+// GetNodePodSubnets returns the pod CIDRs of a node. The sources configured
+// in PodCIDRSources are tried in order and the first one that yields any
+// CIDR wins.
+func GetNodePodSubnets(node *v1.Node) ([]string, error) {
+	for _, source := range GetConfig().GetPodCIDRSources() {
+		var subnets []string
+		switch source {
+		case PodCIDRSourceConfig:
+			subnets = splitCIDRs(GetConfig().PodCIDR)
+		case PodCIDRSourceAnnotation:
+			subnets = splitCIDRs(node.Annotations[AnnotationNodePodSubnet])
+		case PodCIDRSourceSpec:
+			subnets = node.Spec.PodCIDRs
+			if len(subnets) == 0 && node.Spec.PodCIDR != "" {
+				subnets = []string{node.Spec.PodCIDR}
+			}
+		default:
+			return nil, fmt.Errorf("unknown pod CIDR source %q", source)
+		}
 
-	yaml, err := ioutil.ReadFile(ConfigPath)
-	if err != nil {
-		return c, fmt.Errorf("couldn't read config file %q: %s", ConfigPath, err)
+		if len(subnets) > 0 {
+			return subnets, nil
+		}
 	}
 
-	json, err := utilyaml.ToJSON(yaml)
-	if err != nil {
-		return c, fmt.Errorf("couldn't parse config file %q: %s", ConfigPath, err)
-	}
+	return nil, fmt.Errorf("Couldn't figure out nodes PodCIDR. Set spec.podCIDRs, annotation or configfile.")
+}
 
-	if err = utiljson.Unmarshal(json, c); err != nil {
-		return c, fmt.Errorf("couldn't unmarshal config file %q: %s", ConfigPath, err)
+func splitCIDRs(s string) (cidrs []string) {
+	for _, cidr := range strings.Split(s, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr != "" {
+			cidrs = append(cidrs, cidr)
+		}
 	}
-
-	return c, nil
+	return cidrs
 }
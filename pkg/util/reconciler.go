@@ -4,6 +4,7 @@
 package util
 
 import (
+	"sync"
 	"time"
 
 	"github.com/sapcc/kube-parrot/pkg/forked/workqueue"
@@ -14,11 +15,17 @@ import (
 type Interface interface {
 	Reconcile() error
 	Run(stopCh <-chan struct{})
+
+	// Reconciled is closed once the first reconcile succeeded.
+	Reconciled() <-chan struct{}
 }
 
 type Type struct {
 	queue     workqueue.RateLimitingInterface
 	reconcile func() error
+
+	reconciled     chan struct{}
+	reconciledOnce sync.Once
 }
 
 func (c *Type) Run(stopCh <-chan struct{}) {
@@ -44,6 +51,7 @@ func (c *Type) processNextWorkItem() bool {
 
 	if c.Reconcile() == nil {
 		c.queue.Forget(obj)
+		c.reconciledOnce.Do(func() { close(c.reconciled) })
 		return true
 	}
 
@@ -54,3 +62,7 @@ func (c *Type) processNextWorkItem() bool {
 func (c *Type) Reconcile() error {
 	return c.reconcile()
 }
+
+func (c *Type) Reconciled() <-chan struct{} {
+	return c.reconciled
+}